@@ -53,39 +53,38 @@ func Decode(f io.ReadSeeker) (*Sprite, error) {
 		frameCount:       header.frameCount,
 		speed:            header.speed,
 		transparentIndex: header.transparentIndex,
-		pixelRatio:       float32(header.pixelWidth / header.pixelHeight),
-		gridBounds:       image.Rect(int(header.gridX), int(header.gridY), int(header.gridWidth), int(header.gridHeight)),
+		flags:            header.flags,
+		pixelRatio:       PixelRatio{Width: int(header.pixelWidth), Height: int(header.pixelHeight)},
+		gridBounds:       image.Rect(int(header.gridX), int(header.gridY), int(header.gridX)+int(header.gridWidth), int(header.gridY)+int(header.gridHeight)),
 		coreLayers:       []*Layer{},
 		Layers:           make(map[string]*Layer),
+		UserData:         &UserData{},
 	}
 	for frameIndex := uint16(0); frameIndex < header.frameCount; frameIndex++ {
-		err := readFrameHeader(f, frameIndex, header.flags, isIgnoreOldColorChunks, s)
+		err := readFrameHeader(f, frameIndex, header.flags, &isIgnoreOldColorChunks, s)
 		if err != nil {
 			return nil, fmt.Errorf("readFrameHeader %d: %w", frameIndex, err)
 		}
 	}
+	s.Palette = s.PaletteAt(0)
 
 	return s, nil
 }
 
+// readString reads a length prefixed UTF-8 string
 func readString(f io.ReadSeeker) (string, error) {
-	value := ""
 	var length int16
 	err := binary.Read(f, binary.LittleEndian, &length)
 	if err != nil {
 		return "", fmt.Errorf("length: %w", err)
 	}
-	if length == -1 {
+	if length <= 0 {
 		return "", nil
 	}
-	var buf uint8
-	for i := 0; i < int(length); i++ {
-		err := binary.Read(f, binary.LittleEndian, &buf)
-		if err != nil {
-			return "", fmt.Errorf("pos %d: %w", i, err)
-		}
-		value += string(buf)
+	buf := make([]byte, length)
+	_, err = io.ReadFull(f, buf)
+	if err != nil {
+		return "", fmt.Errorf("value: %w", err)
 	}
-
-	return value, nil
+	return string(buf), nil
 }
@@ -1,10 +1,19 @@
 package aseprite
 
 import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
 	"fmt"
+	"image"
+	"image/color"
 	"image/png"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -32,3 +41,1152 @@ func TestLoad(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodeColorDepth(t *testing.T) {
+	pal := testChunk(0x2019, uint32(3), uint32(0), uint32(2), [8]byte{},
+		uint16(0), [4]uint8{0, 0, 0, 255},
+		uint16(0), [4]uint8{255, 0, 0, 255},
+		uint16(0), [4]uint8{10, 20, 30, 100})
+
+	s, err := Decode(bytes.NewReader(testSprite(8, 2, 1, 0,
+		[][]byte{pal, testLayer(1, 0, 0, "indexed"), testRawCel(0, 0, 0, 2, 1, []byte{0, 2})},
+		[][]byte{testRawCel(0, 0, 0, 2, 1, []byte{1, 0})},
+	)))
+	if err != nil {
+		t.Fatalf("indexed: %v", err)
+	}
+	cells := s.coreLayers[0].Cells
+	if got := cells[0].Image.At(0, 0); got != (color.NRGBA{}) {
+		t.Fatalf("transparent index: got %v", got)
+	}
+	if got := cells[0].Image.NRGBAAt(1, 0); got != (color.NRGBA{10, 20, 30, 100}) {
+		t.Fatalf("index 2: got %v", got)
+	}
+	if got := cells[1].Image.At(0, 0); got != (color.NRGBA{R: 255, A: 255}) {
+		t.Fatalf("palette in later frame: got %v", got)
+	}
+
+	s, err = Decode(bytes.NewReader(testSprite(16, 1, 1, 0,
+		[][]byte{testLayer(1, 0, 0, "grayscale"), testRawCel(0, 0, 0, 1, 1, []byte{200, 255})},
+	)))
+	if err != nil {
+		t.Fatalf("grayscale: %v", err)
+	}
+	if got := s.coreLayers[0].Cells[0].Image.At(0, 0); got != (color.NRGBA{R: 200, G: 200, B: 200, A: 255}) {
+		t.Fatalf("grayscale: got %v", got)
+	}
+
+	s, err = Decode(bytes.NewReader(testSprite(32, 1, 1, 0,
+		[][]byte{testLayer(1, 0, 0, "rgba"), testRawCel(0, 0, 0, 1, 1, []byte{200, 100, 50, 3})},
+	)))
+	if err != nil {
+		t.Fatalf("rgba: %v", err)
+	}
+	if got := s.coreLayers[0].Cells[0].Image.NRGBAAt(0, 0); got != (color.NRGBA{200, 100, 50, 3}) {
+		t.Fatalf("translucent rgba: got %v", got)
+	}
+	if got := s.RenderFrame(0).NRGBAAt(0, 0); got != (color.NRGBA{200, 100, 50, 3}) {
+		t.Fatalf("translucent render: got %v", got)
+	}
+}
+
+func TestPalette(t *testing.T) {
+	s, err := Decode(bytes.NewReader(testSprite(8, 1, 1, 0,
+		[][]byte{testChunk(0x2019, uint32(2), uint32(0), uint32(1), [8]byte{},
+			uint16(1), [4]uint8{10, 20, 30, 255}, "shadow",
+			uint16(1), [4]uint8{40, 50, 60, 255}, "café")},
+		[][]byte{},
+		[][]byte{testChunk(0x2019, uint32(3), uint32(2), uint32(2), [8]byte{},
+			uint16(1), [4]uint8{70, 80, 90, 255}, "highlight")},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if s.Palette == nil || s.Palette.Len() != 2 || s.Palette.Name(0) != "shadow" || s.Palette.Name(1) != "café" {
+		t.Fatalf("sprite palette: got %+v", s.Palette)
+	}
+	if s.PaletteAt(1) != s.Palette {
+		t.Fatalf("frame 1 should keep the palette of frame 0")
+	}
+	p := s.PaletteAt(2)
+	if p.Len() != 3 || p.Colors[1] != (color.NRGBA{R: 40, G: 50, B: 60, A: 255}) || p.Name(0) != "shadow" || p.Name(2) != "highlight" {
+		t.Fatalf("frame 2 palette: got %+v", p)
+	}
+	if s.Palette.Len() != 2 {
+		t.Fatalf("palette change modified frame 0 palette")
+	}
+}
+
+func TestTileset(t *testing.T) {
+	//2 tiles of 1x2, tile 0 empty and tile 1 red over blue
+	tiles := testCompress([]byte{
+		0, 0, 0, 0, 0, 0, 0, 0,
+		255, 0, 0, 255, 0, 0, 255, 255,
+	})
+	s, err := Decode(bytes.NewReader(testSprite(32, 4, 4, 0,
+		[][]byte{
+			testChunk(0x2023, uint32(0), uint32(2|4), uint32(2), uint16(1), uint16(2), int16(1), [14]byte{}, "ground", uint32(len(tiles)), tiles),
+			testChunk(0x2023, uint32(1), uint32(1), uint32(0), uint16(8), uint16(8), int16(1), [14]byte{}, "shared", uint32(3), uint32(7)),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(s.Tilesets) != 2 || len(s.coreLayers) != 0 {
+		t.Fatalf("expected 2 tilesets and no layers, got %d and %d", len(s.Tilesets), len(s.coreLayers))
+	}
+	ts := s.Tileset(0)
+	if ts.Name != "ground" || len(ts.Tiles) != 2 || ts.Tiles[1].Bounds() != image.Rect(0, 0, 1, 2) {
+		t.Fatalf("ground: got %+v", ts)
+	}
+	if got := ts.Tiles[1].At(0, 1); got != (color.NRGBA{B: 255, A: 255}) {
+		t.Fatalf("tile 1 pixel: got %v", got)
+	}
+	ts = s.Tileset(1)
+	if !ts.IsExternal() || ts.ExternalFileID != 3 || ts.ExternalTilesetID != 7 || len(ts.Tiles) != 0 {
+		t.Fatalf("shared: got %+v", ts)
+	}
+}
+
+func TestTilemap(t *testing.T) {
+	//tile 1 is a 2x2 tile with a red pixel top left
+	tiles := testCompress([]byte{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		255, 0, 0, 255, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	})
+	cel := testCompress([]byte{
+		1, 0, 0, 0x20, //x flip
+		1, 0, 0, 0xc0, //y flip, rotate 90
+		0, 0, 0, 0,
+	})
+	s, err := Decode(bytes.NewReader(testSprite(32, 6, 2, 0,
+		[][]byte{
+			testChunk(0x2023, uint32(0), uint32(2|4), uint32(2), uint16(2), uint16(2), int16(1), [14]byte{}, "ground", uint32(len(tiles)), tiles),
+			testChunk(0x2004, uint16(1), uint16(2), uint16(0), uint16(0), uint16(0), uint16(0), uint8(255), [3]byte{}, "map", uint32(0)),
+			testChunk(0x2005, uint16(0), int16(0), int16(0), uint8(255), uint16(3), [7]byte{},
+				uint16(3), uint16(1), uint16(32), uint32(0x1fffffff), uint32(0x20000000), uint32(0x40000000), uint32(0x80000000), [10]byte{}, cel),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	tm := s.coreLayers[0].Cells[0].Tilemap
+	if tm == nil || tm.Width != 3 || tm.Height != 1 || tm.Tileset != s.Tileset(0) {
+		t.Fatalf("tilemap: got %+v", tm)
+	}
+	if got := tm.At(0, 0); got != (Tile{ID: 1, FlipX: true}) {
+		t.Fatalf("tile 0: got %+v", got)
+	}
+	if got := tm.At(1, 0); got != (Tile{ID: 1, FlipY: true, Rotate90: true}) {
+		t.Fatalf("tile 1: got %+v", got)
+	}
+	img := s.coreLayers[0].Cells[0].Image
+	red := color.NRGBA{R: 255, A: 255}
+	if img.Bounds() != image.Rect(0, 0, 6, 2) || img.At(1, 0) != red || img.At(2, 1) != red {
+		t.Fatalf("tilemap image: got %v", img.Pix)
+	}
+}
+
+func TestLayerHierarchy(t *testing.T) {
+	s, err := Decode(bytes.NewReader(testSprite(32, 1, 1, 1|2,
+		[][]byte{
+			testLayer(1, 1, 0, "body"),
+			testLayer(0, 1, 1, "arm"),
+			testLayer(1, 0, 2, "shadow"),
+			testLayer(1, 0, 1, "legs"),
+			testLayer(1, 0, 0, "background"),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	roots := s.RootLayers()
+	if len(roots) != 2 || roots[0].Name != "body" || roots[1].Name != "background" {
+		t.Fatalf("root layers: got %v", roots)
+	}
+	body := roots[0]
+	if len(body.Children()) != 2 || body.Children()[0].Name != "arm" || body.Children()[1].Name != "legs" {
+		t.Fatalf("body children: got %v", body.Children())
+	}
+	shadow := body.Children()[0].Children()[0]
+	if shadow.Name != "shadow" || shadow.Parent().Parent() != body || shadow.Level() != 2 {
+		t.Fatalf("shadow: got %+v", shadow)
+	}
+	if shadow.EffectiveVisible() || !body.Children()[1].EffectiveVisible() {
+		t.Fatalf("shadow should be hidden by its group, legs should be visible")
+	}
+
+	names := ""
+	err = s.WalkLayers(func(layer *Layer) error {
+		names += layer.Name + ","
+		return nil
+	})
+	if err != nil || names != "body,arm,shadow,legs,background," {
+		t.Fatalf("walk: got %s %v", names, err)
+	}
+}
+
+func TestLayerLookup(t *testing.T) {
+	s, err := Decode(bytes.NewReader(testSprite(32, 1, 1, 0,
+		[][]byte{
+			testLayer(1, 1, 0, "body"),
+			testLayer(1, 0, 1, "Shadow"),
+			testLayer(1, 1, 0, "head"),
+			testLayer(1, 0, 1, "shadow"),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if s.LayerCount() != 4 || s.LayerAt(3).Index() != 3 || s.LayerAt(4) != nil {
+		t.Fatalf("layer index: got %d layers", s.LayerCount())
+	}
+	shadows := s.LayersByName("shadow")
+	if len(shadows) != 2 || shadows[0] != s.LayerAt(1) || shadows[1] != s.LayerAt(3) {
+		t.Fatalf("layers by name: got %v", shadows)
+	}
+	if layer := s.LayerByPath("head/shadow"); layer != s.LayerAt(3) || layer.Path() != "head/shadow" {
+		t.Fatalf("layer by path: got %+v", layer)
+	}
+	if s.LayerByPath("head/arm") != nil {
+		t.Fatalf("missing path should return nil")
+	}
+}
+
+func TestLinkedCels(t *testing.T) {
+	s, err := Decode(bytes.NewReader(testSprite(32, 1, 1, 0,
+		[][]byte{testLayer(1, 0, 0, "empty first"), testLayer(1, 0, 0, "linked")},
+		[][]byte{testRawCel(1, 0, 0, 1, 1, []byte{255, 0, 0, 255})},
+		[][]byte{},
+		[][]byte{testChunk(0x2005, uint16(1), int16(0), int16(0), uint8(255), uint16(1), [7]byte{}, uint16(1))},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	layer := s.LayerAt(1)
+	if layer.CelAt(0) != nil || layer.CelAt(2) != nil || s.LayerAt(0).CelAt(1) != nil {
+		t.Fatalf("empty frames should not have cels")
+	}
+	src, link := layer.CelAt(1), layer.CelAt(3)
+	if src == nil || link == nil || src.IsLinked() {
+		t.Fatalf("expected cels at frames 1 and 3")
+	}
+	if link.LinkedFrame != 1 || link.FrameIndex() != 3 || link.Image != src.Image {
+		t.Fatalf("link: got %+v", link)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	data := testSprite(32, 1, 1, 0,
+		[][]byte{testLayer(1, 0, 0, "bottom"), testLayer(1, 0, 0, "top"), testRawCel(1, 0, 0, 1, 1, []byte{0, 0, 0, 255}), testRawCel(0, 0, 0, 1, 1, []byte{0, 0, 0, 255})},
+		[][]byte{},
+	)
+	binary.LittleEndian.PutUint16(data[18:], 50)   //header speed
+	binary.LittleEndian.PutUint16(data[128+8:], 0) //frame 0 duration
+	s, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(s.Frames) != 2 || s.Frame(0).Duration != 50*time.Millisecond || s.Frame(1).Duration != 100*time.Millisecond {
+		t.Fatalf("frame durations: got %v and %v", s.Frame(0).Duration, s.Frame(1).Duration)
+	}
+	cels := s.Frame(0).Cels
+	if len(cels) != 2 || cels[0].Layer().Name != "bottom" || cels[1].Layer().Name != "top" {
+		t.Fatalf("frame 0 cels should be in layer order")
+	}
+	if len(s.Frame(1).Cels) != 0 || s.Duration() != 150*time.Millisecond {
+		t.Fatalf("frame 1 should be empty, total duration %v", s.Duration())
+	}
+}
+
+func TestSlices(t *testing.T) {
+	s, err := Decode(bytes.NewReader(testSprite(32, 32, 32, 0,
+		[][]byte{testChunk(0x2022, uint32(2), uint32(1|2), uint32(0), "button",
+			uint32(2), int32(4), int32(4), uint32(8), uint32(6), int32(1), int32(1), uint32(6), uint32(4), int32(4), int32(3),
+			uint32(0), int32(0), int32(0), uint32(16), uint32(16), int32(2), int32(2), uint32(12), uint32(12), int32(8), int32(8),
+		)},
+		[][]byte{},
+		[][]byte{},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(s.Slices()) != 1 || s.Slices()[0].Name != "button" {
+		t.Fatalf("slices: got %v", s.Slices())
+	}
+	sl := s.Slices()[0]
+	if key := sl.At(1); key != sl.Keys[0] || key.Frame != 0 || key.Bounds != image.Rect(0, 0, 16, 16) {
+		t.Fatalf("key at frame 1: got %+v", key)
+	}
+	key := sl.At(2)
+	if key.Bounds != image.Rect(4, 4, 12, 10) || *key.Center != image.Rect(1, 1, 7, 5) || *key.Pivot != image.Pt(4, 3) {
+		t.Fatalf("key at frame 2: got %+v", key)
+	}
+}
+
+func TestMask(t *testing.T) {
+	s, err := Decode(bytes.NewReader(testSprite(32, 16, 16, 0,
+		[][]byte{testChunk(0x2016, int16(2), int16(3), uint16(9), uint16(2), [8]byte{}, "selection",
+			[]byte{0x80, 0x80, 0x7f, 0x00})},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(s.Masks) != 1 || s.Masks[0].Name != "selection" || s.Masks[0].Bounds() != image.Rect(2, 3, 11, 5) {
+		t.Fatalf("masks: got %+v", s.Masks)
+	}
+	img := s.Masks[0].Image
+	if img.AlphaAt(2, 3).A != 255 || img.AlphaAt(3, 3).A != 0 || img.AlphaAt(10, 3).A != 255 || img.AlphaAt(2, 4).A != 0 || img.AlphaAt(3, 4).A != 255 {
+		t.Fatalf("mask bits: got %v", img.Pix)
+	}
+}
+
+func TestUserDataProperties(t *testing.T) {
+	maps := testFields(uint32(2),
+		uint32(0), uint32(4),
+		"damage", uint16(0x0006), int32(12),
+		"speed", uint16(0x000A), int32(0x18000),
+		"hitbox", uint16(0x0010), [4]int32{1, 2, 3, 4},
+		"tags", uint16(0x0011), uint32(2), uint16(0), uint16(0x000D), "fire", uint16(0x0001), uint8(1),
+		uint32(3), uint32(1),
+		"nested", uint16(0x0012), uint32(1), "on", uint16(0x0001), uint8(1),
+	)
+	s, err := Decode(bytes.NewReader(testSprite(32, 1, 1, 0,
+		[][]byte{
+			testLayer(1, 0, 0, "enemy"),
+			testChunk(0x2020, uint32(1|4), "boss", uint32(len(maps)+4), maps),
+			testLayer(1, 0, 0, "next"),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	ud := s.LayerAt(0).UserData
+	props := ud.UserProperties()
+	if ud.Text != "boss" || props == nil {
+		t.Fatalf("user data: got %+v", ud)
+	}
+	if damage, ok := props.Int("damage"); !ok || damage != 12 {
+		t.Fatalf("damage: got %v", damage)
+	}
+	if speed, ok := props.Float("speed"); !ok || speed != 1.5 {
+		t.Fatalf("speed: got %v", speed)
+	}
+	if hitbox, ok := props.Rect("hitbox"); !ok || hitbox != image.Rect(1, 2, 4, 6) {
+		t.Fatalf("hitbox: got %v", hitbox)
+	}
+	if tags, ok := props.Vector("tags"); !ok || len(tags) != 2 || tags[0] != "fire" || tags[1] != true {
+		t.Fatalf("tags: got %v", tags)
+	}
+	if nested, ok := ud.Properties[3].Map("nested"); !ok || nested["on"] != true {
+		t.Fatalf("extension properties: got %v", ud.Properties[3])
+	}
+	if s.LayerAt(1) == nil || s.LayerAt(1).Name != "next" {
+		t.Fatalf("chunks after user data should still be read")
+	}
+}
+
+func TestUserDataTargets(t *testing.T) {
+	s, err := Decode(bytes.NewReader(testSprite(32, 1, 1, 0,
+		[][]byte{
+			testChunk(0x2019, uint32(1), uint32(0), uint32(0), [8]byte{}, uint16(0), [4]uint8{0, 0, 0, 255}),
+			testChunk(0x2020, uint32(1), "sprite"),
+			testChunk(0x2018, uint16(2), [8]byte{},
+				uint16(0), uint16(0), uint8(0), uint16(0), [6]byte{}, [3]uint8{}, uint8(0), "idle",
+				uint16(0), uint16(0), uint8(0), uint16(0), [6]byte{}, [3]uint8{}, uint8(0), "walk"),
+			testChunk(0x2020, uint32(1), "idle notes"),
+			testChunk(0x2020, uint32(2), [4]uint8{255, 0, 0, 255}),
+			testChunk(0x2023, uint32(0), uint32(1), uint32(2), uint16(8), uint16(8), int16(1), [14]byte{}, "ground", uint32(0), uint32(0)),
+			testChunk(0x2020, uint32(1), "tileset"),
+			testChunk(0x2020, uint32(0)),
+			testChunk(0x2020, uint32(1), "tile 1"),
+			testLayer(1, 0, 0, "ref"),
+			testRawCel(0, 0, 0, 1, 1, []byte{0, 0, 0, 255}),
+			testChunk(0x2006, uint32(1), int32(0), int32(0), int32(0x10000), int32(0x10000), [16]byte{}),
+			testChunk(0x2020, uint32(1), "cel"),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if s.UserData.Text != "sprite" {
+		t.Fatalf("sprite user data: got %+v", s.UserData)
+	}
+	if s.Tags[0].UserData.Text != "idle notes" || s.Tags[1].UserData.Color != (color.RGBA{R: 255, A: 255}) {
+		t.Fatalf("tag user data: got %+v and %+v", s.Tags[0].UserData, s.Tags[1].UserData)
+	}
+	ts := s.Tileset(0)
+	if ts.UserData.Text != "tileset" || ts.TileUserData[0].Text != "" || ts.TileUserData[1].Text != "tile 1" {
+		t.Fatalf("tileset user data: got %+v", ts)
+	}
+	if got := s.LayerAt(0).CelAt(0).UserData.Text; got != "cel" {
+		t.Fatalf("cel user data after cel extra: got %q", got)
+	}
+
+	//aseprite skips empty sprite user data, the tags chunk then follows the palette directly
+	s, err = Decode(bytes.NewReader(testSprite(32, 1, 1, 0,
+		[][]byte{
+			testChunk(0x2019, uint32(1), uint32(0), uint32(0), [8]byte{}, uint16(0), [4]uint8{0, 0, 0, 255}),
+			testChunk(0x2018, uint16(2), [8]byte{},
+				uint16(0), uint16(0), uint8(0), uint16(0), [6]byte{}, [3]uint8{}, uint8(0), "idle",
+				uint16(0), uint16(0), uint8(0), uint16(0), [6]byte{}, [3]uint8{}, uint8(0), "walk"),
+			testChunk(0x2020, uint32(1), "idle notes"),
+			testChunk(0x2020, uint32(1), "walk notes"),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode without sprite user data: %v", err)
+	}
+	if s.UserData.Text != "" || s.Tags[0].UserData.Text != "idle notes" || s.Tags[1].UserData.Text != "walk notes" {
+		t.Fatalf("user data without sprite user data: got %q, %q and %q", s.UserData.Text, s.Tags[0].UserData.Text, s.Tags[1].UserData.Text)
+	}
+}
+
+func TestExternalFiles(t *testing.T) {
+	tiles := testCompress([]byte{0, 0, 0, 0, 0, 255, 0, 255})
+	shared := testSprite(32, 1, 1, 0,
+		[][]byte{testChunk(0x2023, uint32(5), uint32(2), uint32(2), uint16(1), uint16(1), int16(1), [14]byte{}, "shared", uint32(len(tiles)), tiles)},
+	)
+	colors := testSprite(32, 1, 1, 0,
+		[][]byte{testChunk(0x2019, uint32(1), uint32(0), uint32(0), [8]byte{}, uint16(0), [4]uint8{1, 2, 3, 255})},
+	)
+	s, err := Decode(bytes.NewReader(testSprite(32, 1, 1, 0,
+		[][]byte{
+			testChunk(0x2008, uint32(3), [8]byte{},
+				uint32(1), uint8(1), [7]byte{}, "tiles/shared.aseprite",
+				uint32(2), uint8(2), [7]byte{}, "my-extension",
+				uint32(3), uint8(0), [7]byte{}, "palettes\\colors.aseprite"),
+			testChunk(0x2023, uint32(0), uint32(1), uint32(0), uint16(1), uint16(1), int16(1), [14]byte{}, "level", uint32(1), uint32(5)),
+			testChunk(0x2004, uint16(1), uint16(2), uint16(0), uint16(0), uint16(0), uint16(0), uint8(255), [3]byte{}, "map", uint32(0)),
+			testChunk(0x2005, uint16(0), int16(0), int16(0), uint8(255), uint16(3), [7]byte{},
+				uint16(1), uint16(1), uint16(32), uint32(0x1fffffff), uint32(0x20000000), uint32(0x40000000), uint32(0x80000000), [10]byte{}, testCompress([]byte{1, 0, 0, 0})),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(s.ExternalFiles) != 3 || s.ExternalFile(1).Type != ExternalTileset || s.ExternalFile(2).Name != "my-extension" {
+		t.Fatalf("external files: got %+v", s.ExternalFiles)
+	}
+	if s.LayerAt(0).CelAt(0).Image != nil {
+		t.Fatalf("tilemap of an unresolved tileset should have no image")
+	}
+	err = s.ResolveExternalFiles(FSResolver(fstest.MapFS{
+		"tiles/shared.aseprite":    {Data: shared},
+		"palettes/colors.aseprite": {Data: colors},
+	}))
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if len(s.Tileset(0).Tiles) != 2 {
+		t.Fatalf("external tiles: got %d", len(s.Tileset(0).Tiles))
+	}
+	if got := s.LayerAt(0).CelAt(0).Image.At(0, 0); got != (color.NRGBA{G: 255, A: 255}) {
+		t.Fatalf("resolved tilemap: got %v", got)
+	}
+	if pal := s.ExternalPalette(3); pal == nil || pal.Len() != 1 || pal.Colors[0] != (color.NRGBA{1, 2, 3, 255}) {
+		t.Fatalf("external palette: got %+v", pal)
+	}
+	if s.ExternalPalette(1) != nil {
+		t.Fatalf("tileset entry should have no palette")
+	}
+
+	dir := t.TempDir()
+	err = os.MkdirAll(filepath.Join(dir, "palettes"), 0755)
+	if err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "palettes", "colors.aseprite"), colors, 0644)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := DirResolver(dir)("palettes\\colors.aseprite"); err != nil {
+		t.Fatalf("dir resolver with backslashes: %v", err)
+	}
+}
+
+func TestColorProfile(t *testing.T) {
+	//ICC profile with sRGB colorants and linear tone curves
+	colorants := [3][3]float64{{0.4360747, 0.2225045, 0.0139322}, {0.3850649, 0.7168786, 0.0971045}, {0.1430804, 0.0606169, 0.7141733}}
+	tags := &bytes.Buffer{}
+	table := &bytes.Buffer{}
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ", "rTRC", "gTRC", "bTRC"} {
+		data := &bytes.Buffer{}
+		if i < 3 {
+			data.WriteString("XYZ \x00\x00\x00\x00")
+			for _, value := range colorants[i] {
+				binary.Write(data, binary.BigEndian, int32(value*65536))
+			}
+		} else {
+			data.WriteString("curv\x00\x00\x00\x00")
+			binary.Write(data, binary.BigEndian, uint32(1))
+			binary.Write(data, binary.BigEndian, uint16(0x0100))
+		}
+		table.WriteString(sig)
+		binary.Write(table, binary.BigEndian, uint32(132+6*12+tags.Len()))
+		binary.Write(table, binary.BigEndian, uint32(data.Len()))
+		tags.Write(data.Bytes())
+	}
+	icc := append(make([]byte, 128), testFields(uint32(0))...)
+	binary.BigEndian.PutUint32(icc[128:], 6)
+	icc = append(append(icc, table.Bytes()...), tags.Bytes()...)
+
+	for _, chunk := range [][]byte{
+		testChunk(0x2007, uint16(1), uint16(1), int32(1<<16), [8]byte{}),
+		testChunk(0x2007, uint16(2), uint16(0), int32(0), [8]byte{}, uint32(len(icc)), icc),
+	} {
+		s, err := Decode(bytes.NewReader(testSprite(32, 1, 1, 0, [][]byte{chunk, testLayer(1, 0, 0, "after profile")})))
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if s.ColorProfile == nil || s.ColorProfile.IsSRGB() || s.LayerAt(0) == nil {
+			t.Fatalf("color profile: got %+v", s.ColorProfile)
+		}
+		img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+		img.Set(0, 0, color.NRGBA{R: 128, G: 128, B: 128, A: 255})
+		err = s.ColorProfile.ConvertToSRGB(img)
+		if err != nil {
+			t.Fatalf("convert: %v", err)
+		}
+		if got := img.RGBAAt(0, 0); got.R < 187 || got.R > 189 || got.G < 187 || got.G > 189 || got.B < 187 || got.B > 189 {
+			t.Fatalf("linear 128 should become sRGB 188, got %v", got)
+		}
+	}
+
+	s, err := Decode(bytes.NewReader(testSprite(32, 1, 1, 0, [][]byte{
+		testChunk(0x2007, uint16(1), uint16(1), int32(1<<16), [8]byte{}),
+		testLayer(1, 0, 0, "linear"),
+		testRawCel(0, 0, 0, 1, 1, []byte{128, 128, 128, 100}),
+	})))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	img, err := s.RenderFrameWithOptions(0, RenderOptions{ConvertToSRGB: true})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if got := img.NRGBAAt(0, 0); got.R < 187 || got.R > 189 || got.G != got.R || got.B != got.R || got.A != 100 {
+		t.Fatalf("rendered linear 128 should become sRGB 188, got %v", got)
+	}
+	if got := s.RenderFrame(0).NRGBAAt(0, 0); got != (color.NRGBA{128, 128, 128, 100}) {
+		t.Fatalf("render without conversion: got %v", got)
+	}
+}
+
+func TestOldColorChunks(t *testing.T) {
+	s, err := Decode(bytes.NewReader(testSprite(8, 1, 1, 0,
+		[][]byte{testChunk(0x0011, uint16(2), uint8(1), uint8(1), [3]uint8{63, 32, 0}, uint8(1), uint8(1), [3]uint8{1, 2, 3})},
+		[][]byte{testChunk(0x0004, uint16(1), uint8(2), uint8(1), [3]uint8{10, 20, 30})},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	p := s.PaletteAt(0)
+	if p.Len() != 4 || p.Colors[1] != (color.NRGBA{R: 255, G: 130, B: 0, A: 255}) || p.Colors[3] != (color.NRGBA{R: 4, G: 8, B: 12, A: 255}) {
+		t.Fatalf("6 bit palette: got %v", p.Colors)
+	}
+	if p = s.PaletteAt(1); p.Colors[2] != (color.NRGBA{R: 10, G: 20, B: 30, A: 255}) || p.Colors[1] != s.PaletteAt(0).Colors[1] {
+		t.Fatalf("8 bit palette: got %v", p.Colors)
+	}
+
+	s, err = Decode(bytes.NewReader(testSprite(8, 1, 1, 0,
+		[][]byte{
+			testChunk(0x2019, uint32(1), uint32(0), uint32(0), [8]byte{}, uint16(0), [4]uint8{1, 2, 3, 255}),
+			testChunk(0x0004, uint16(1), uint8(0), uint8(1), [3]uint8{10, 20, 30}),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if s.Palette.Colors[0] != (color.NRGBA{R: 1, G: 2, B: 3, A: 255}) {
+		t.Fatalf("old color chunk should be ignored after a palette chunk, got %v", s.Palette.Colors)
+	}
+}
+
+func TestTags(t *testing.T) {
+	s, err := Decode(bytes.NewReader(testSprite(32, 1, 1, 0,
+		[][]byte{testChunk(0x2018, uint16(1), [8]byte{},
+			uint16(1), uint16(3), uint8(3), uint16(2), [6]byte{}, [3]uint8{1, 2, 3}, uint8(0), "swing")},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	tag := s.Tags[0]
+	if tag.Name != "swing" || tag.Direction != DirectionPingPongReverse || tag.Repeat != 2 || tag.Color != (color.RGBA{R: 1, G: 2, B: 3, A: 255}) {
+		t.Fatalf("tag: got %+v", tag)
+	}
+
+	tests := []struct {
+		direction Direction
+		repeat    uint16
+		want      string
+	}{
+		{DirectionForward, 0, "[1 2 3]"},
+		{DirectionForward, 2, "[1 2 3 1 2 3]"},
+		{DirectionReverse, 1, "[3 2 1]"},
+		{DirectionPingPong, 0, "[1 2 3 2]"},
+		{DirectionPingPong, 3, "[1 2 3 2 1 2 3]"},
+		{DirectionPingPongReverse, 0, "[3 2 1 2]"},
+		{DirectionPingPongReverse, 2, "[3 2 1 2 3]"},
+	}
+	for _, test := range tests {
+		tag := &Tag{From: 1, To: 3, Direction: test.direction, Repeat: test.repeat}
+		if got := fmt.Sprint(tag.Sequence()); got != test.want {
+			t.Fatalf("%s repeat %d: got %s, want %s", test.direction, test.repeat, got, test.want)
+		}
+	}
+}
+
+func TestLayerFlags(t *testing.T) {
+	uuid := UUID{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 1, 2, 3, 4, 5, 6, 7, 8}
+	s, err := Decode(bytes.NewReader(testSprite(32, 1, 1, 1|4,
+		[][]byte{
+			testChunk(0x2004, uint16(1|2|16), uint16(2), uint16(0), uint16(0), uint16(0), uint16(0), uint8(255), [3]byte{}, "map", uint32(7), uuid),
+			testChunk(0x2004, uint16(4|8|32|64), uint16(0), uint16(0), uint16(0), uint16(0), uint16(0), uint8(255), [3]byte{}, "reference", UUID{}),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	tilemap, reference := s.LayerAt(0), s.LayerAt(1)
+	if !tilemap.IsTilemap() || tilemap.TilesetIndex != 7 || tilemap.UUID.String() != "12345678-9abc-def0-0102-030405060708" {
+		t.Fatalf("tilemap: got %+v", tilemap)
+	}
+	if !tilemap.Visible() || !tilemap.Editable() || !tilemap.PreferLinkedCels() || tilemap.IsBackground() || tilemap.IsReference() {
+		t.Fatalf("tilemap flags: got %d", tilemap.Flags)
+	}
+	if reference.Name != "reference" || reference.Visible() || !reference.LockMovement() || !reference.IsBackground() || !reference.Collapsed() || !reference.IsReference() {
+		t.Fatalf("reference flags: got %+v", reference)
+	}
+}
+
+func TestPreciseBounds(t *testing.T) {
+	s, err := Decode(bytes.NewReader(testSprite(32, 8, 8, 0,
+		[][]byte{
+			testLayer(1, 0, 0, "scaled"),
+			testRawCel(0, 1, 2, 1, 1, []byte{0, 0, 0, 255}),
+			testChunk(0x2006, uint32(1), int32(0x18000), int32(0x24000), int32(0x28000), int32(0x10000), [16]byte{}),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	b := s.LayerAt(0).CelAt(0).PreciseBounds
+	if b == nil {
+		t.Fatalf("precise bounds missing")
+	}
+	if x, y, w, h := b.Float64(); x != 1.5 || y != 2.25 || w != 2.5 || h != 1 {
+		t.Fatalf("precise bounds: got %v %v %v %v", x, y, w, h)
+	}
+	if b.Rect() != image.Rect(1, 2, 4, 4) {
+		t.Fatalf("precise rect: got %v", b.Rect())
+	}
+}
+
+func TestOrderedCels(t *testing.T) {
+	cel := func(layerIndex uint16, zIndex int16) []byte {
+		return testChunk(0x2005, layerIndex, int16(0), int16(0), uint8(255), uint16(0), zIndex, [5]byte{}, uint16(1), uint16(1), []byte{0, 0, 0, 255})
+	}
+	s, err := Decode(bytes.NewReader(testSprite(32, 1, 1, 0,
+		[][]byte{testLayer(1, 0, 0, "body"), testLayer(1, 0, 0, "arm"), testLayer(1, 0, 0, "head"), cel(0, 0), cel(1, 0), cel(2, 0)},
+		[][]byte{cel(0, 0), cel(1, -1), cel(2, 0)},
+		[][]byte{cel(0, 0), cel(1, 1), cel(2, 0)},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for frameIndex, want := range []string{"body,arm,head,", "arm,body,head,", "body,head,arm,"} {
+		got := ""
+		for _, c := range s.Frame(frameIndex).OrderedCels() {
+			got += c.Layer().Name + ","
+		}
+		if got != want {
+			t.Fatalf("frame %d: got %s, want %s", frameIndex, got, want)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	data := testSprite(8, 4, 4, 1, [][]byte{})
+	data[28] = 3 //transparent index
+	binary.LittleEndian.PutUint16(data[32:], 16)
+	data[34], data[35] = 1, 2
+	copy(data[36:], testFields(int16(2), int16(3), uint16(8), uint16(4)))
+	s, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if s.ColorMode() != ColorModeIndexed || s.TransparentIndex() != 3 || s.NumColors() != 16 || !s.HasLayerOpacity() || s.Flags() != 1 {
+		t.Fatalf("header: got %v %d %d %d", s.ColorMode(), s.TransparentIndex(), s.NumColors(), s.Flags())
+	}
+	if pr := s.PixelRatio(); pr != (PixelRatio{Width: 1, Height: 2}) || pr.Float64() != 0.5 {
+		t.Fatalf("pixel ratio: got %v", pr)
+	}
+	if s.Grid() != image.Rect(2, 3, 10, 7) {
+		t.Fatalf("grid: got %v", s.Grid())
+	}
+}
+
+func TestRenderFrame(t *testing.T) {
+	layer := func(flags uint16, layerType uint16, childLevel uint16, opacity uint8, name string) []byte {
+		return testChunk(0x2004, flags, layerType, childLevel, uint16(0), uint16(0), uint16(0), opacity, [3]byte{}, name)
+	}
+	s, err := Decode(bytes.NewReader(testSprite(32, 2, 1, 1,
+		[][]byte{
+			layer(1, 0, 0, 255, "bg"),
+			layer(1, 0, 0, 128, "top"),
+			layer(0, 1, 0, 255, "hidden"),
+			layer(1, 0, 1, 255, "child"),
+			layer(1, 0, 0, 255, "edge"),
+			testRawCel(0, 0, 0, 2, 1, []byte{255, 0, 0, 255, 255, 0, 0, 255}),
+			testRawCel(1, 1, 0, 1, 1, []byte{0, 0, 255, 255}),
+			testRawCel(3, 0, 0, 2, 1, []byte{0, 255, 0, 255, 0, 255, 0, 255}),
+			testRawCel(4, -1, 0, 2, 1, []byte{0, 255, 0, 255, 0, 0, 0, 0}),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	img := s.RenderFrame(0)
+	if img == nil || img.Bounds() != image.Rect(0, 0, 2, 1) {
+		t.Fatalf("bounds: got %v", img)
+	}
+	if got := img.NRGBAAt(0, 0); got != (color.NRGBA{255, 0, 0, 255}) {
+		t.Fatalf("pixel 0: got %v", got)
+	}
+	if got := img.NRGBAAt(1, 0); got != (color.NRGBA{127, 0, 128, 255}) {
+		t.Fatalf("pixel 1: got %v", got)
+	}
+	if s.RenderFrame(1) != nil {
+		t.Fatalf("expected nil for out of range frame")
+	}
+}
+
+func TestBlendModes(t *testing.T) {
+	backdrop := color.NRGBA{200, 100, 50, 255}
+	src := color.NRGBA{100, 200, 255, 255}
+	for _, tt := range []struct {
+		blendMode int16
+		want      color.NRGBA
+	}{
+		{blendModeNormal, color.NRGBA{100, 200, 255, 255}},
+		{blendModeMultiply, color.NRGBA{78, 78, 50, 255}},
+		{blendModeScreen, color.NRGBA{222, 222, 255, 255}},
+		{blendModeDarken, color.NRGBA{100, 100, 50, 255}},
+		{blendModeLighten, color.NRGBA{200, 200, 255, 255}},
+		{blendModeDifference, color.NRGBA{100, 100, 205, 255}},
+		{blendModeAddition, color.NRGBA{255, 255, 255, 255}},
+		{blendModeSubtract, color.NRGBA{100, 0, 0, 255}},
+		{blendModeDivide, color.NRGBA{255, 128, 50, 255}},
+		{blendModeColorDodge, color.NRGBA{255, 255, 255, 255}},
+		{blendModeColorBurn, color.NRGBA{115, 57, 50, 255}},
+		{blendModeOverlay, color.NRGBA{188, 157, 100, 255}},
+		{blendModeHardLight, color.NRGBA{157, 188, 255, 255}},
+		{blendModeSoftLight, color.NRGBA{191, 134, 113, 255}},
+		{blendModeExclusion, color.NRGBA{144, 144, 205, 255}},
+		{blendModeHslHue, color.NRGBA{50, 147, 200, 255}},
+		{blendModeHslSaturation, color.NRGBA{202, 99, 47, 255}},
+	} {
+		if got := blendFunc(tt.blendMode)(backdrop, src, 255); got != tt.want {
+			t.Errorf("blend mode %d: got %v, want %v", tt.blendMode, got, tt.want)
+		}
+	}
+	red := color.NRGBA{255, 0, 0, 255}
+	white := color.NRGBA{255, 255, 255, 255}
+	black := color.NRGBA{0, 0, 0, 255}
+	if got := blendFunc(blendModeHslColor)(white, red, 255); got != white {
+		t.Errorf("hsl color: got %v, want %v", got, white)
+	}
+	if got := blendFunc(blendModeHslLuminosity)(red, black, 255); got != black {
+		t.Errorf("hsl luminosity: got %v, want %v", got, black)
+	}
+	if got := blendFunc(blendModeMultiply)(white, color.NRGBA{0, 0, 0, 255}, 128); got != (color.NRGBA{127, 127, 127, 255}) {
+		t.Errorf("multiply at half opacity: got %v", got)
+	}
+
+	//translucent backdrop and source
+	backdrop.A = 128
+	src.A = 100
+	for _, tt := range []struct {
+		blendMode int16
+		opacity   int
+		want      color.NRGBA
+	}{
+		{blendModeNormal, 255, color.NRGBA{144, 156, 165, 178}},
+		{blendModeMultiply, 255, color.NRGBA{137, 115, 96, 178}},
+		{blendModeMultiply, 128, color.NRGBA{164, 110, 80, 153}},
+	} {
+		if got := blendFunc(tt.blendMode)(backdrop, src, tt.opacity); got != tt.want {
+			t.Errorf("translucent blend mode %d at %d: got %v, want %v", tt.blendMode, tt.opacity, got, tt.want)
+		}
+	}
+
+	//every mode places the source like normal blending over a transparent backdrop
+	for blendMode := blendModeNormal; blendMode <= blendModeDivide; blendMode++ {
+		if got := blendFunc(blendMode)(color.NRGBA{}, src, 128); got != (color.NRGBA{100, 200, 255, 50}) {
+			t.Errorf("blend mode %d over transparent: got %v", blendMode, got)
+		}
+	}
+
+	s, err := Decode(bytes.NewReader(testSprite(32, 2, 1, 1,
+		[][]byte{
+			testLayer(1, 0, 0, "base"),
+			testChunk(0x2004, uint16(1), uint16(0), uint16(0), uint16(0), uint16(0), uint16(blendModeMultiply), uint8(255), [3]byte{}, "light"),
+			testRawCel(0, 0, 0, 1, 1, []byte{255, 255, 255, 255}),
+			testRawCel(1, 0, 0, 2, 1, []byte{0, 0, 255, 255, 0, 0, 255, 255}),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	img := s.RenderFrame(0)
+	if got := img.NRGBAAt(0, 0); got != (color.NRGBA{0, 0, 255, 255}) {
+		t.Errorf("multiply over white: got %v", got)
+	}
+	if got := img.NRGBAAt(1, 0); got != (color.NRGBA{0, 0, 255, 255}) {
+		t.Errorf("multiply over an empty pixel: got %v", got)
+	}
+}
+
+// TestRenderGolden compares rendered frames with the images aseprite exports. Each testdata/golden/name.aseprite
+// is checked against name.png, its first frame exported with aseprite -b name.aseprite --save-as name.png,
+// see testdata/golden/README.md
+func TestRenderGolden(t *testing.T) {
+	paths, err := filepath.Glob("testdata/golden/*.aseprite")
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no golden files in testdata/golden")
+	}
+	for _, path := range paths {
+		s, err := Load(path)
+		if err != nil {
+			t.Fatalf("load %s: %v", path, err)
+		}
+		r, err := os.Open(strings.TrimSuffix(path, ".aseprite") + ".png")
+		if err != nil {
+			t.Errorf("open aseprite export of %s: %v", path, err)
+			continue
+		}
+		want, err := png.Decode(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("decode golden %s: %v", path, err)
+		}
+		got := s.RenderFrame(0)
+		if got.Bounds() != want.Bounds() {
+			t.Fatalf("%s: bounds %v, want %v", path, got.Bounds(), want.Bounds())
+		}
+		for y := want.Bounds().Min.Y; y < want.Bounds().Max.Y; y++ {
+			for x := want.Bounds().Min.X; x < want.Bounds().Max.X; x++ {
+				wc := color.NRGBAModel.Convert(want.At(x, y)).(color.NRGBA)
+				gc := got.NRGBAAt(x, y)
+				if wc.A == 0 && gc.A == 0 {
+					continue
+				}
+				if gc != wc {
+					t.Errorf("%s: pixel %d,%d is %v, want %v", path, x, y, gc, wc)
+				}
+			}
+		}
+	}
+}
+
+func TestRenderOptions(t *testing.T) {
+	pixel := func(layerIndex uint16, r, g, b uint8) []byte {
+		return testRawCel(layerIndex, 0, 0, 1, 1, []byte{r, g, b, 255})
+	}
+	s, err := Decode(bytes.NewReader(testSprite(32, 1, 1, 0,
+		[][]byte{
+			testLayer(9, 0, 0, "bg"),
+			testLayer(1, 1, 0, "fx"),
+			testLayer(1, 0, 1, "glow"),
+			testLayer(0, 0, 0, "hidden"),
+			testLayer(65, 0, 0, "ref"),
+			pixel(0, 255, 0, 0),
+			pixel(2, 0, 255, 0),
+			pixel(3, 0, 0, 255),
+			pixel(4, 255, 255, 255),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	red := color.NRGBA{255, 0, 0, 255}
+	green := color.NRGBA{0, 255, 0, 255}
+	for _, tt := range []struct {
+		opts RenderOptions
+		want color.NRGBA
+	}{
+		{RenderOptions{}, green},
+		{RenderOptions{ShowHidden: true}, color.NRGBA{0, 0, 255, 255}},
+		{RenderOptions{ReferenceLayers: true}, color.NRGBA{255, 255, 255, 255}},
+		{RenderOptions{Exclude: []string{"fx"}}, red},
+		{RenderOptions{Include: []string{"bg"}}, red},
+		{RenderOptions{Include: []string{"FX/*"}}, green},
+		{RenderOptions{Include: []string{"bg"}, NoBackground: true}, color.NRGBA{}},
+		{RenderOptions{Solo: "fx", ShowHidden: true}, green},
+	} {
+		img, err := s.RenderFrameWithOptions(0, tt.opts)
+		if err != nil {
+			t.Fatalf("render %+v: %v", tt.opts, err)
+		}
+		if got := img.NRGBAAt(0, 0); got != tt.want {
+			t.Errorf("render %+v: got %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+	if _, err := s.RenderFrameWithOptions(0, RenderOptions{Solo: "missing"}); err == nil {
+		t.Fatalf("expected error for missing solo group")
+	}
+	if _, err := s.RenderFrameWithOptions(0, RenderOptions{Include: []string{"["}}); err == nil {
+		t.Fatalf("expected error for bad pattern")
+	}
+}
+
+func TestRenderScale(t *testing.T) {
+	data := testSprite(32, 2, 1, 0,
+		[][]byte{
+			testLayer(1, 0, 0, "a"),
+			testRawCel(0, 0, 0, 2, 1, []byte{255, 0, 0, 255, 0, 0, 255, 255}),
+		},
+	)
+	data[34] = 2 //pixel width
+	data[35] = 1 //pixel height
+	s, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, tt := range []struct {
+		opts   RenderOptions
+		bounds image.Rectangle
+	}{
+		{RenderOptions{}, image.Rect(0, 0, 2, 1)},
+		{RenderOptions{Scale: 3}, image.Rect(0, 0, 6, 3)},
+		{RenderOptions{PixelRatio: true}, image.Rect(0, 0, 4, 1)},
+		{RenderOptions{Scale: 2, PixelRatio: true}, image.Rect(0, 0, 8, 2)},
+	} {
+		img, err := s.RenderFrameWithOptions(0, tt.opts)
+		if err != nil {
+			t.Fatalf("render %+v: %v", tt.opts, err)
+		}
+		if img.Bounds() != tt.bounds {
+			t.Fatalf("render %+v: bounds %v, want %v", tt.opts, img.Bounds(), tt.bounds)
+		}
+		half := img.Bounds().Dx() / 2
+		for y := 0; y < img.Bounds().Dy(); y++ {
+			for x := 0; x < img.Bounds().Dx(); x++ {
+				want := color.NRGBA{255, 0, 0, 255}
+				if x >= half {
+					want = color.NRGBA{0, 0, 255, 255}
+				}
+				if got := img.NRGBAAt(x, y); got != want {
+					t.Fatalf("render %+v: pixel %d,%d is %v, want %v", tt.opts, x, y, got, want)
+				}
+			}
+		}
+	}
+	if _, err := s.RenderFrameWithOptions(0, RenderOptions{Scale: -1}); err == nil {
+		t.Fatalf("expected error for negative scale")
+	}
+}
+
+func TestRenderFrameIndexed(t *testing.T) {
+	palette := testChunk(0x2019, uint32(4), uint32(0), uint32(3), [8]byte{},
+		uint16(0), [4]uint8{0, 0, 0, 255},
+		uint16(0), [4]uint8{255, 0, 0, 255},
+		uint16(0), [4]uint8{255, 0, 0, 255},
+		uint16(0), [4]uint8{0, 0, 255, 255})
+	s, err := Decode(bytes.NewReader(testSprite(8, 2, 1, 0,
+		[][]byte{palette, testLayer(1, 0, 0, "a"), testLayer(1, 0, 0, "b"), testRawCel(0, 0, 0, 2, 1, []byte{2, 0})},
+		[][]byte{testRawCel(0, 0, 0, 2, 1, []byte{2, 0}), testChunk(0x2005, uint16(1), int16(0), int16(0), uint8(128), uint16(0), [7]byte{}, uint16(1), uint16(1), []byte{3})},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	img, err := s.RenderFrameIndexed(0, RenderOptions{Scale: 2})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 4, 2) || img.ColorIndexAt(1, 1) != 2 || img.ColorIndexAt(2, 0) != 0 {
+		t.Fatalf("indices: got %v %v", img.Bounds(), img.Pix)
+	}
+	if _, _, _, a := img.Palette[0].RGBA(); a != 0 {
+		t.Fatalf("transparent index should be transparent in the palette")
+	}
+	_, err = s.RenderFrameIndexed(1, RenderOptions{})
+	if err == nil {
+		t.Fatalf("expected error for blended colors")
+	}
+	img, err = s.RenderFrameIndexed(1, RenderOptions{NearestIndex: true})
+	if err != nil {
+		t.Fatalf("render nearest: %v", err)
+	}
+	if img.ColorIndexAt(1, 0) != 0 {
+		t.Fatalf("unblended pixel should keep its index, got %d", img.ColorIndexAt(1, 0))
+	}
+
+	//translucent palette entries keep their index unless they cover another pixel
+	palette = testChunk(0x2019, uint32(3), uint32(0), uint32(2), [8]byte{},
+		uint16(0), [4]uint8{0, 0, 0, 255},
+		uint16(0), [4]uint8{10, 20, 30, 100},
+		uint16(0), [4]uint8{10, 20, 30, 100})
+	s, err = Decode(bytes.NewReader(testSprite(8, 2, 1, 0,
+		[][]byte{palette, testLayer(1, 0, 0, "a"), testLayer(1, 0, 0, "b"), testRawCel(0, 0, 0, 2, 1, []byte{2, 1})},
+		[][]byte{testRawCel(0, 0, 0, 2, 1, []byte{2, 1}), testRawCel(1, 0, 0, 1, 1, []byte{1})},
+	)))
+	if err != nil {
+		t.Fatalf("decode translucent: %v", err)
+	}
+	img, err = s.RenderFrameIndexed(0, RenderOptions{})
+	if err != nil {
+		t.Fatalf("render translucent: %v", err)
+	}
+	if img.ColorIndexAt(0, 0) != 2 || img.ColorIndexAt(1, 0) != 1 {
+		t.Fatalf("translucent indices: got %v", img.Pix)
+	}
+	if got := color.NRGBAModel.Convert(img.At(0, 0)); got != (color.NRGBA{10, 20, 30, 100}) {
+		t.Fatalf("translucent color: got %v", got)
+	}
+	_, err = s.RenderFrameIndexed(1, RenderOptions{})
+	if err == nil {
+		t.Fatalf("expected error for a translucent entry over another pixel")
+	}
+
+	//blend modes keep indices over empty pixels
+	s, err = Decode(bytes.NewReader(testSprite(8, 2, 1, 1,
+		[][]byte{
+			palette,
+			testLayer(1, 0, 0, "base"),
+			testChunk(0x2004, uint16(1), uint16(0), uint16(0), uint16(0), uint16(0), uint16(blendModeMultiply), uint8(255), [3]byte{}, "light"),
+			testRawCel(1, 0, 0, 1, 1, []byte{2}),
+		},
+		[][]byte{
+			testRawCel(0, 1, 0, 1, 1, []byte{2}),
+			testRawCel(1, 0, 0, 2, 1, []byte{1, 1}),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode multiply: %v", err)
+	}
+	img, err = s.RenderFrameIndexed(0, RenderOptions{})
+	if err != nil {
+		t.Fatalf("render multiply over an empty pixel: %v", err)
+	}
+	if img.ColorIndexAt(0, 0) != 2 {
+		t.Fatalf("multiply over an empty pixel should keep its index, got %d", img.ColorIndexAt(0, 0))
+	}
+	_, err = s.RenderFrameIndexed(1, RenderOptions{})
+	if err == nil {
+		t.Fatalf("expected error for multiply over another pixel")
+	}
+}
+
+func TestRenderOrder(t *testing.T) {
+	cel := func(layerIndex uint16, zIndex int16, r, g, b uint8) []byte {
+		return testChunk(0x2005, layerIndex, int16(0), int16(0), uint8(255), uint16(0), zIndex, [5]byte{}, uint16(1), uint16(1), []byte{r, g, b, 255})
+	}
+	//A, group G containing B, then D moved below B by its z-index
+	s, err := Decode(bytes.NewReader(testSprite(32, 1, 1, 0,
+		[][]byte{
+			testLayer(1, 0, 0, "A"), testLayer(1, 1, 0, "G"), testLayer(1, 0, 1, "B"), testLayer(1, 0, 0, "D"),
+			cel(0, 0, 255, 0, 0), cel(2, 0, 0, 255, 0), cel(3, -1, 0, 0, 255),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got := s.RenderFrame(0).NRGBAAt(0, 0); got != (color.NRGBA{0, 255, 0, 255}) {
+		t.Fatalf("flat groups: B should be on top, got %v", got)
+	}
+
+	//with composite groups, z-indices move layers among their siblings:
+	//D goes below G, and C below its sibling E inside G
+	s, err = Decode(bytes.NewReader(testSprite(32, 1, 1, 2,
+		[][]byte{
+			testLayer(1, 0, 0, "A"), testLayer(1, 1, 0, "G"), testLayer(1, 0, 1, "E"), testLayer(1, 0, 1, "C"), testLayer(1, 0, 0, "D"),
+			cel(0, 0, 255, 0, 0), cel(2, 0, 0, 255, 0), cel(3, -1, 255, 255, 0), cel(4, -1, 0, 0, 255),
+		},
+	)))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got := s.RenderFrame(0).NRGBAAt(0, 0); got != (color.NRGBA{0, 255, 0, 255}) {
+		t.Fatalf("composite groups: E should be on top, got %v", got)
+	}
+}
+
+// testFields encodes fields in little endian order, strings are prefixed by their length
+func testFields(fields ...interface{}) []byte {
+	buf := &bytes.Buffer{}
+	for _, field := range fields {
+		if str, ok := field.(string); ok {
+			binary.Write(buf, binary.LittleEndian, uint16(len(str)))
+			buf.WriteString(str)
+			continue
+		}
+		binary.Write(buf, binary.LittleEndian, field)
+	}
+	return buf.Bytes()
+}
+
+// testChunk encodes a chunk of chunkType with fields written in little endian order
+func testChunk(chunkType uint16, fields ...interface{}) []byte {
+	body := testFields(fields...)
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, uint32(len(body)+6))
+	binary.Write(buf, binary.LittleEndian, chunkType)
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// testLayer encodes a layer chunk
+func testLayer(flags uint16, layerType uint16, childLevel uint16, name string) []byte {
+	return testChunk(0x2004, flags, layerType, childLevel, uint16(0), uint16(0), uint16(0), uint8(255), [3]byte{}, name)
+}
+
+// testRawCel encodes a raw cel chunk
+func testRawCel(layerIndex uint16, x int16, y int16, w uint16, h uint16, pixels []byte) []byte {
+	return testChunk(0x2005, layerIndex, x, y, uint8(255), uint16(0), [7]byte{}, w, h, pixels)
+}
+
+// testCompress zlib compresses data
+func testCompress(data []byte) []byte {
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// testSprite encodes a sprite, each frame being a list of chunks
+func testSprite(depth uint16, width uint16, height uint16, flags uint32, frames ...[][]byte) []byte {
+	body := &bytes.Buffer{}
+	for _, chunks := range frames {
+		frame := &bytes.Buffer{}
+		for _, chunk := range chunks {
+			frame.Write(chunk)
+		}
+		binary.Write(body, binary.LittleEndian, uint32(frame.Len()+16))
+		binary.Write(body, binary.LittleEndian, uint16(0xF1FA))
+		binary.Write(body, binary.LittleEndian, uint16(len(chunks)))
+		binary.Write(body, binary.LittleEndian, uint16(100))
+		binary.Write(body, binary.LittleEndian, [2]byte{})
+		binary.Write(body, binary.LittleEndian, uint32(len(chunks)))
+		body.Write(frame.Bytes())
+	}
+
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, uint32(body.Len()+128))
+	binary.Write(buf, binary.LittleEndian, uint16(0xA5E0))
+	binary.Write(buf, binary.LittleEndian, uint16(len(frames)))
+	binary.Write(buf, binary.LittleEndian, width)
+	binary.Write(buf, binary.LittleEndian, height)
+	binary.Write(buf, binary.LittleEndian, depth)
+	binary.Write(buf, binary.LittleEndian, flags)
+	binary.Write(buf, binary.LittleEndian, uint16(100))
+	binary.Write(buf, binary.LittleEndian, [2]uint32{})
+	buf.Write(make([]byte, 128-buf.Len()))
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
@@ -0,0 +1,347 @@
+package aseprite
+
+import (
+	"image/color"
+	"math"
+)
+
+// blender blends a source color over a backdrop color with an opacity from 0 to 255
+type blender func(backdrop color.NRGBA, src color.NRGBA, opacity int) color.NRGBA
+
+// blendFunc returns the blender of blendMode, falling back to normal for unknown modes.
+// Blend modes stored in files use aseprite's default blending, see blendComposite
+func blendFunc(blendMode int16) blender {
+	switch blendMode {
+	case blendModeSrc:
+		return blendSrc
+	case blendModeMerge:
+		return blendMerge
+	case blendModeNegBw:
+		return blendNegBw
+	case blendModeRedTint:
+		return blendRedTint
+	case blendModeBlueTint:
+		return blendBlueTint
+	case blendModeDstOver:
+		return blendDstOver
+	}
+	blend := modeBlender(blendMode)
+	if blend == nil {
+		return blendNormal
+	}
+	return blendComposite(blend)
+}
+
+// blendComposite returns aseprite's default blending for blend: pixels over a transparent backdrop are placed
+// with normal blending, otherwise the normal and blended results are mixed by the alpha of the backdrop and source
+func blendComposite(blend blender) blender {
+	return func(backdrop color.NRGBA, src color.NRGBA, opacity int) color.NRGBA {
+		if backdrop.A == 0 {
+			return blendNormal(backdrop, src, opacity)
+		}
+		normal := blendNormal(backdrop, src, opacity)
+		blended := blend(backdrop, src, opacity)
+		normalToBlend := blendMerge(normal, blended, int(backdrop.A))
+		compositeAlpha := mulUn8(int(backdrop.A), mulUn8(int(src.A), opacity))
+		return blendMerge(normalToBlend, blended, compositeAlpha)
+	}
+}
+
+// modeBlender returns the blender of blendMode as if the backdrop was opaque, or nil for normal and unknown modes
+func modeBlender(blendMode int16) blender {
+	switch blendMode {
+	case blendModeMultiply:
+		return blendSeparable(func(b, s int) int { return mulUn8(b, s) })
+	case blendModeScreen:
+		return blendSeparable(blendScreen)
+	case blendModeOverlay:
+		return blendSeparable(func(b, s int) int { return blendHardLight(s, b) })
+	case blendModeDarken:
+		return blendSeparable(func(b, s int) int {
+			if b < s {
+				return b
+			}
+			return s
+		})
+	case blendModeLighten:
+		return blendSeparable(func(b, s int) int {
+			if b > s {
+				return b
+			}
+			return s
+		})
+	case blendModeColorDodge:
+		return blendSeparable(blendColorDodge)
+	case blendModeColorBurn:
+		return blendSeparable(blendColorBurn)
+	case blendModeHardLight:
+		return blendSeparable(blendHardLight)
+	case blendModeSoftLight:
+		return blendSeparable(blendSoftLight)
+	case blendModeDifference:
+		return blendSeparable(func(b, s int) int {
+			if b > s {
+				return b - s
+			}
+			return s - b
+		})
+	case blendModeExclusion:
+		return blendSeparable(func(b, s int) int { return b + s - 2*mulUn8(b, s) })
+	case blendModeHslHue:
+		return blendNonSeparable(func(b, s [3]float64) [3]float64 {
+			return setLum(setSat(s, sat(b)), lum(b))
+		})
+	case blendModeHslSaturation:
+		return blendNonSeparable(func(b, s [3]float64) [3]float64 {
+			return setLum(setSat(b, sat(s)), lum(b))
+		})
+	case blendModeHslColor:
+		return blendNonSeparable(func(b, s [3]float64) [3]float64 {
+			return setLum(s, lum(b))
+		})
+	case blendModeHslLuminosity:
+		return blendNonSeparable(func(b, s [3]float64) [3]float64 {
+			return setLum(b, lum(s))
+		})
+	case blendModeAddition:
+		return blendSeparable(func(b, s int) int {
+			if b+s > 255 {
+				return 255
+			}
+			return b + s
+		})
+	case blendModeSubtract:
+		return blendSeparable(func(b, s int) int {
+			if b-s < 0 {
+				return 0
+			}
+			return b - s
+		})
+	case blendModeDivide:
+		return blendSeparable(blendDivide)
+	}
+	return nil
+}
+
+// blendNormal is aseprite's normal blender, placing src over backdrop
+func blendNormal(backdrop color.NRGBA, src color.NRGBA, opacity int) color.NRGBA {
+	if backdrop.A == 0 {
+		src.A = uint8(mulUn8(int(src.A), opacity))
+		return src
+	}
+	if src.A == 0 {
+		return backdrop
+	}
+	sa := mulUn8(int(src.A), opacity)
+	ra := sa + int(backdrop.A) - mulUn8(int(backdrop.A), sa)
+	return color.NRGBA{
+		R: uint8(int(backdrop.R) + (int(src.R)-int(backdrop.R))*sa/ra),
+		G: uint8(int(backdrop.G) + (int(src.G)-int(backdrop.G))*sa/ra),
+		B: uint8(int(backdrop.B) + (int(src.B)-int(backdrop.B))*sa/ra),
+		A: uint8(ra),
+	}
+}
+
+// blendSeparable returns a blender mixing each channel of backdrop and src with fn, then placing the result with normal blending
+func blendSeparable(fn func(b, s int) int) blender {
+	return func(backdrop color.NRGBA, src color.NRGBA, opacity int) color.NRGBA {
+		src.R = uint8(fn(int(backdrop.R), int(src.R)))
+		src.G = uint8(fn(int(backdrop.G), int(src.G)))
+		src.B = uint8(fn(int(backdrop.B), int(src.B)))
+		return blendNormal(backdrop, src, opacity)
+	}
+}
+
+// blendNonSeparable returns a blender mixing backdrop and src as 0-1 rgb triplets with fn, then placing the result with normal blending
+func blendNonSeparable(fn func(b, s [3]float64) [3]float64) blender {
+	return func(backdrop color.NRGBA, src color.NRGBA, opacity int) color.NRGBA {
+		b := [3]float64{float64(backdrop.R) / 255, float64(backdrop.G) / 255, float64(backdrop.B) / 255}
+		s := [3]float64{float64(src.R) / 255, float64(src.G) / 255, float64(src.B) / 255}
+		r := fn(b, s)
+		src.R = uint8(255 * r[0])
+		src.G = uint8(255 * r[1])
+		src.B = uint8(255 * r[2])
+		return blendNormal(backdrop, src, opacity)
+	}
+}
+
+func blendScreen(b, s int) int {
+	return b + s - mulUn8(b, s)
+}
+
+func blendHardLight(b, s int) int {
+	if s < 128 {
+		return mulUn8(b, s<<1)
+	}
+	return blendScreen(b, (s<<1)-255)
+}
+
+func blendColorDodge(b, s int) int {
+	if b == 0 {
+		return 0
+	}
+	s = 255 - s
+	if b >= s {
+		return 255
+	}
+	return divUn8(b, s)
+}
+
+func blendColorBurn(b, s int) int {
+	if b == 255 {
+		return 255
+	}
+	b = 255 - b
+	if b >= s {
+		return 0
+	}
+	return 255 - divUn8(b, s)
+}
+
+func blendSoftLight(b, s int) int {
+	fb := float64(b) / 255
+	fs := float64(s) / 255
+	var d float64
+	if fb <= 0.25 {
+		d = ((16*fb-12)*fb + 4) * fb
+	} else {
+		d = math.Sqrt(fb)
+	}
+	var r float64
+	if fs <= 0.5 {
+		r = fb - (1-2*fs)*fb*(1-fb)
+	} else {
+		r = fb + (2*fs-1)*(d-fb)
+	}
+	return int(r*255 + 0.5)
+}
+
+func blendDivide(b, s int) int {
+	if b == 0 {
+		return 0
+	}
+	if b >= s {
+		return 255
+	}
+	return divUn8(b, s)
+}
+
+// lum returns the luminosity of an rgb triplet
+func lum(c [3]float64) float64 {
+	return 0.3*c[0] + 0.59*c[1] + 0.11*c[2]
+}
+
+// sat returns the saturation of an rgb triplet
+func sat(c [3]float64) float64 {
+	return math.Max(c[0], math.Max(c[1], c[2])) - math.Min(c[0], math.Min(c[1], c[2]))
+}
+
+// clipColor brings an rgb triplet back into the 0-1 range while keeping its luminosity
+func clipColor(c [3]float64) [3]float64 {
+	l := lum(c)
+	n := math.Min(c[0], math.Min(c[1], c[2]))
+	x := math.Max(c[0], math.Max(c[1], c[2]))
+	for i := range c {
+		if n < 0 {
+			c[i] = l + (c[i]-l)*l/(l-n)
+		}
+	}
+	for i := range c {
+		if x > 1 {
+			c[i] = l + (c[i]-l)*(1-l)/(x-l)
+		}
+	}
+	return c
+}
+
+// setLum shifts an rgb triplet to luminosity l
+func setLum(c [3]float64, l float64) [3]float64 {
+	d := l - lum(c)
+	return clipColor([3]float64{c[0] + d, c[1] + d, c[2] + d})
+}
+
+// setSat scales an rgb triplet to saturation s, keeping its hue
+func setSat(c [3]float64, s float64) [3]float64 {
+	minIndex, midIndex, maxIndex := 0, 1, 2
+	if c[minIndex] > c[midIndex] {
+		minIndex, midIndex = midIndex, minIndex
+	}
+	if c[midIndex] > c[maxIndex] {
+		midIndex, maxIndex = maxIndex, midIndex
+	}
+	if c[minIndex] > c[midIndex] {
+		minIndex, midIndex = midIndex, minIndex
+	}
+	var r [3]float64
+	if c[maxIndex] > c[minIndex] {
+		r[midIndex] = (c[midIndex] - c[minIndex]) * s / (c[maxIndex] - c[minIndex])
+		r[maxIndex] = s
+	}
+	return r
+}
+
+// blendSrc replaces the backdrop with src
+func blendSrc(backdrop color.NRGBA, src color.NRGBA, opacity int) color.NRGBA {
+	return src
+}
+
+// blendMerge interpolates from backdrop to src by opacity
+func blendMerge(backdrop color.NRGBA, src color.NRGBA, opacity int) color.NRGBA {
+	r := backdrop
+	switch {
+	case backdrop.A == 0:
+		r.R, r.G, r.B = src.R, src.G, src.B
+	case src.A != 0:
+		r.R = uint8(int(backdrop.R) + mulUn8(int(src.R)-int(backdrop.R), opacity))
+		r.G = uint8(int(backdrop.G) + mulUn8(int(src.G)-int(backdrop.G), opacity))
+		r.B = uint8(int(backdrop.B) + mulUn8(int(src.B)-int(backdrop.B), opacity))
+	}
+	r.A = uint8(int(backdrop.A) + mulUn8(int(src.A)-int(backdrop.A), opacity))
+	if r.A == 0 {
+		r.R, r.G, r.B = 0, 0, 0
+	}
+	return r
+}
+
+// blendNegBw paints black or white depending on the luma of the backdrop
+func blendNegBw(backdrop color.NRGBA, src color.NRGBA, opacity int) color.NRGBA {
+	if backdrop.A == 0 || luma(backdrop) >= 128 {
+		return color.NRGBA{A: 255}
+	}
+	return color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+}
+
+// blendRedTint places the luma of src tinted red over backdrop
+func blendRedTint(backdrop color.NRGBA, src color.NRGBA, opacity int) color.NRGBA {
+	v := luma(src)
+	return blendNormal(backdrop, color.NRGBA{R: uint8((255 + v) / 2), G: uint8(v / 2), B: uint8(v / 2), A: src.A}, opacity)
+}
+
+// blendBlueTint places the luma of src tinted blue over backdrop
+func blendBlueTint(backdrop color.NRGBA, src color.NRGBA, opacity int) color.NRGBA {
+	v := luma(src)
+	return blendNormal(backdrop, color.NRGBA{R: uint8(v / 2), G: uint8(v / 2), B: uint8((255 + v) / 2), A: src.A}, opacity)
+}
+
+// blendDstOver places backdrop over src
+func blendDstOver(backdrop color.NRGBA, src color.NRGBA, opacity int) color.NRGBA {
+	src.A = uint8(mulUn8(int(src.A), opacity))
+	return blendNormal(src, backdrop, 255)
+}
+
+// luma returns the luma of c from 0 to 255
+func luma(c color.NRGBA) int {
+	return (int(c.R)*2126 + int(c.G)*7152 + int(c.B)*722) / 10000
+}
+
+// mulUn8 multiplies two values from 0 to 255 as if they were in the 0-1 range, rounding like aseprite.
+// a may be negative, e.g. the difference of two channels, the shifts then round down like aseprite's C code
+func mulUn8(a int, b int) int {
+	t := a*b + 0x80
+	return ((t >> 8) + t) >> 8
+}
+
+// divUn8 divides two values from 0 to 255 as if they were in the 0-1 range, rounding like aseprite
+func divUn8(a int, b int) int {
+	return (a*255 + b/2) / b
+}
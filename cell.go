@@ -11,22 +11,28 @@ import (
 
 // Cell represents an image
 type Cell struct {
-	PositionX   int16
-	PositionY   int16
-	Opacity     int8
-	Image       *image.RGBA
-	frameIndex  uint16
-	boundsFixed image.Rectangle
-	Duration    uint16
-	UserData    *UserData
-	EbitenImage *ebiten.Image
+	PositionX     int16
+	PositionY     int16
+	Opacity       int8
+	ZIndex        int16        // moves the cel up or down among the layers of its frame, see Frame.OrderedCels
+	Image         *image.NRGBA // non-premultiplied pixels of the cel, as stored in the file
+	Tilemap       *Tilemap     // set for cels of tilemap layers, Image then holds the tiles drawn with the layer's tileset
+	LinkedFrame   int          // frame of the cel this one is linked to, -1 if the cel is not linked
+	frameIndex    uint16
+	layer         *Layer
+	indexes       *image.Paletted // palette indices of the cel for indexed sprites
+	PreciseBounds *PreciseBounds  // sub-pixel placement of the cel, nil when the file doesn't store one
+	Duration      uint16
+	UserData      *UserData
+	EbitenImage   *ebiten.Image
 }
 
-func readCellChunk(f io.ReadSeeker, layers []*Layer, frameIndex uint16, chunkSize uint32, pal *palette, duration uint16) (*Cell, error) {
+func readCellChunk(f io.ReadSeeker, s *Sprite, frameIndex uint16, duration uint16) (*Cell, error) {
 	// log := log.New()
 	var err error
 	c := new(Cell)
 	c.UserData = &UserData{}
+	c.LinkedFrame = -1
 	c.Duration = duration
 	var layerIndex int16
 
@@ -54,7 +60,11 @@ func readCellChunk(f io.ReadSeeker, layers []*Layer, frameIndex uint16, chunkSiz
 	if err != nil {
 		return nil, fmt.Errorf("celType: %w", err)
 	}
-	_, err = f.Seek(7, 1)
+	err = binary.Read(f, binary.LittleEndian, &c.ZIndex)
+	if err != nil {
+		return nil, fmt.Errorf("zIndex: %w", err)
+	}
+	_, err = f.Seek(5, 1)
 	if err != nil {
 		return nil, fmt.Errorf("seek celType: %w", err)
 	}
@@ -62,14 +72,19 @@ func readCellChunk(f io.ReadSeeker, layers []*Layer, frameIndex uint16, chunkSiz
 	if layerIndex < 0 {
 		return nil, fmt.Errorf("invalid layer index %d", layerIndex)
 	}
-	if len(layers) <= int(layerIndex) {
-		return nil, fmt.Errorf("layerIndex %d out of bound of layers (%d)", layerIndex, len(layers))
+	if len(s.coreLayers) <= int(layerIndex) {
+		return nil, fmt.Errorf("layerIndex %d out of bound of layers (%d)", layerIndex, len(s.coreLayers))
 	}
-	layer := layers[int(layerIndex)]
-	if !layer.isImage {
+	layer := s.coreLayers[int(layerIndex)]
+	if !layer.isImage && !layer.isTileset {
 		return nil, fmt.Errorf("layer %d does not contain image", layerIndex)
 	}
-	var img *image.RGBA
+	pixelFormat := pixelFormatFromDepth(s.depth)
+	transparentIndex := int(s.transparentIndex)
+	if layer.IsBackground() { //background layers are opaque, even with the transparent index
+		transparentIndex = -1
+	}
+	var img *image.NRGBA
 	switch celType {
 	case 0: //ASE_FILE_RAW_CEL
 		var w int16
@@ -84,7 +99,7 @@ func readCellChunk(f io.ReadSeeker, layers []*Layer, frameIndex uint16, chunkSiz
 		}
 
 		if w > 0 && h > 0 {
-			img, err = readRawImage(f, pixelFormatIMAGERGB, w, h, pal)
+			img, c.indexes, err = readRawImage(f, pixelFormat, int(w), int(h), s.palettes[frameIndex], transparentIndex)
 			if err != nil {
 				return nil, fmt.Errorf("raw_cell readImage: %w", err)
 			}
@@ -96,22 +111,24 @@ func readCellChunk(f io.ReadSeeker, layers []*Layer, frameIndex uint16, chunkSiz
 		c.Image = img
 	case 1: //ASE_FILE_LINK_CEL
 		// log.Debug().Msg("link cell")
-		var linkFrame int16
+		var linkFrame uint16
 		err = binary.Read(f, binary.LittleEndian, &linkFrame)
 		if err != nil {
 			return nil, fmt.Errorf("link_cell linkFrame: %w", err)
 		}
-		if len(layer.Cells) <= int(linkFrame) {
-			return nil, fmt.Errorf("link_cell linkFrame %d out of bounds (%d)", linkFrame, len(layer.Cells))
+		link := layer.CelAt(int(linkFrame))
+		if link == nil {
+			return nil, fmt.Errorf("link_cell linkFrame %d has no cel", linkFrame)
 		}
 
-		link := layer.Cells[int(linkFrame)]
 		c.PositionX = link.PositionX
 		c.PositionY = link.PositionY
 		c.Image = link.Image
+		c.indexes = link.indexes
+		c.Tilemap = link.Tilemap
 		c.Opacity = link.Opacity
+		c.LinkedFrame = int(linkFrame)
 		c.frameIndex = frameIndex
-		fmt.Println("link", c)
 	case 2: //ASE_FILE_COMPRESSED_CEL
 		// log.Debug().Msg("compressed cell")
 		var w int16
@@ -128,9 +145,9 @@ func readCellChunk(f io.ReadSeeker, layers []*Layer, frameIndex uint16, chunkSiz
 			return nil, fmt.Errorf("compressed_cell %dx%d is invalid", w, h)
 		}
 
-		img, err = readCompressedImage(f, pixelFormatIMAGERGB, w, h, chunkSize, pal)
+		img, c.indexes, err = readCompressedImage(f, pixelFormat, int(w), int(h), s.palettes[frameIndex], transparentIndex)
 		if err != nil {
-			return nil, fmt.Errorf("raw_cell readImage: %w", err)
+			return nil, fmt.Errorf("compressed_cell readImage: %w", err)
 		}
 		c.PositionX = x
 		c.PositionY = y
@@ -159,22 +176,22 @@ func readCellChunk(f io.ReadSeeker, layers []*Layer, frameIndex uint16, chunkSiz
 		if bitsPerTile != 32 {
 			return nil, fmt.Errorf("bitsPerTile expected 32, got %d", bitsPerTile)
 		}
-		var bitMaskTileID int32 //(e.g. 0x1fffffff for 32-bit tiles)
+		var bitMaskTileID uint32 //(e.g. 0x1fffffff for 32-bit tiles)
 		err = binary.Read(f, binary.LittleEndian, &bitMaskTileID)
 		if err != nil {
 			return nil, fmt.Errorf("bitMaskTileID: %w", err)
 		}
-		var bitMaskXFlip int32
+		var bitMaskXFlip uint32
 		err = binary.Read(f, binary.LittleEndian, &bitMaskXFlip)
 		if err != nil {
 			return nil, fmt.Errorf("bitMaskXFlip: %w", err)
 		}
-		var bitMaskYFlip int32
+		var bitMaskYFlip uint32
 		err = binary.Read(f, binary.LittleEndian, &bitMaskYFlip)
 		if err != nil {
 			return nil, fmt.Errorf("bitMaskYFlip: %w", err)
 		}
-		var bitMask90CWRot int32
+		var bitMask90CWRot uint32
 		err = binary.Read(f, binary.LittleEndian, &bitMask90CWRot)
 		if err != nil {
 			return nil, fmt.Errorf("bitMask90CWRot: %w", err)
@@ -185,20 +202,46 @@ func readCellChunk(f io.ReadSeeker, layers []*Layer, frameIndex uint16, chunkSiz
 			return nil, fmt.Errorf("seek 10: %w", err)
 		}
 		//log.Debug().Msgf("tile %dx%d bitsPerTile: %d", w, h, bitsPerTile)
-		return nil, fmt.Errorf("wut")
-		img, err = readCompressedImage(f, pixelFormatIMAGERGB, w, h, chunkSize, pal)
+		tiles, err := readTiles(f, int(w), int(h), bitMaskTileID, bitMaskXFlip, bitMaskYFlip, bitMask90CWRot)
 		if err != nil {
-			return nil, fmt.Errorf("raw_cell readImage: %w", err)
+			return nil, fmt.Errorf("compressed_tilemap readTiles: %w", err)
+		}
+		c.Tilemap = &Tilemap{
+			Width:   int(w),
+			Height:  int(h),
+			Tiles:   tiles,
+			Tileset: s.Tileset(layer.TilesetIndex),
 		}
 		c.PositionX = x
 		c.PositionY = y
 		c.frameIndex = frameIndex
 		c.Opacity = opacity
-		c.Image = img
+		c.Image = c.Tilemap.image()
+		c.indexes = c.Tilemap.indexes(int(s.transparentIndex))
 	default:
 		return nil, fmt.Errorf("unknown cellType %d", celType)
 	}
 
+	c.layer = layer
 	layer.Cells = append(layer.Cells, c)
+	if layer.cels == nil {
+		layer.cels = make(map[uint16]*Cell)
+	}
+	layer.cels[frameIndex] = c
 	return c, nil
 }
+
+// FrameIndex returns the frame the cel belongs to
+func (c *Cell) FrameIndex() int {
+	return int(c.frameIndex)
+}
+
+// Layer returns the layer the cel belongs to
+func (c *Cell) Layer() *Layer {
+	return c.layer
+}
+
+// IsLinked returns true if the cel shares its image with the cel at LinkedFrame
+func (c *Cell) IsLinked() bool {
+	return c.LinkedFrame >= 0
+}
@@ -7,6 +7,26 @@ import (
 	"io"
 )
 
+// PreciseBounds is the sub-pixel position and size of a cel inside the sprite
+type PreciseBounds struct {
+	X      Fixed
+	Y      Fixed
+	Width  Fixed
+	Height Fixed
+}
+
+// Float64 returns the bounds as floats
+func (b *PreciseBounds) Float64() (x float64, y float64, width float64, height float64) {
+	return b.X.Float64(), b.Y.Float64(), b.Width.Float64(), b.Height.Float64()
+}
+
+// Rect returns the smallest pixel rectangle containing the bounds
+func (b *PreciseBounds) Rect() image.Rectangle {
+	maxX := b.X + b.Width
+	maxY := b.Y + b.Height
+	return image.Rect(b.X.Int(), b.Y.Int(), (maxX + 0xFFFF).Int(), (maxY + 0xFFFF).Int())
+}
+
 func readCelExtraChunk(f io.ReadSeeker, c *Cell) error {
 	var err error
 	var flags int32
@@ -15,28 +35,25 @@ func readCelExtraChunk(f io.ReadSeeker, c *Cell) error {
 		return fmt.Errorf("flags: %w", err)
 	}
 	if flags&1 == 1 { //ASE_CEL_EXTRA_FLAG_PRECISE_BOUNDS
-		var x int32
-		err = binary.Read(f, binary.LittleEndian, &x)
+		b := &PreciseBounds{}
+		err = binary.Read(f, binary.LittleEndian, &b.X)
 		if err != nil {
 			return fmt.Errorf("x: %w", err)
 		}
-		var y int32
-		err = binary.Read(f, binary.LittleEndian, &y)
+		err = binary.Read(f, binary.LittleEndian, &b.Y)
 		if err != nil {
 			return fmt.Errorf("y: %w", err)
 		}
-		var w int32
-		err = binary.Read(f, binary.LittleEndian, &w)
+		err = binary.Read(f, binary.LittleEndian, &b.Width)
 		if err != nil {
 			return fmt.Errorf("w: %w", err)
 		}
-		var h int32
-		err = binary.Read(f, binary.LittleEndian, &h)
+		err = binary.Read(f, binary.LittleEndian, &b.Height)
 		if err != nil {
 			return fmt.Errorf("h: %w", err)
 		}
-		if w > 0 && h > 0 {
-			c.boundsFixed = image.Rect(int(x), int(y), int(w), int(h))
+		if b.Width > 0 && b.Height > 0 {
+			c.PreciseBounds = b
 		}
 	}
 	return nil
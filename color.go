@@ -7,52 +7,52 @@ import (
 	"io"
 )
 
-func readColorChunk(f io.ReadSeeker) (*palette, error) {
+// readColorChunk applies a legacy color chunk on top of pal, which may be nil, and returns the result as a new palette.
+// is6Bit is set for ASE_FILE_CHUNK_FLI_COLOR2 chunks, which store components in the 0-63 range
+func readColorChunk(f io.ReadSeeker, pal *Palette, is6Bit bool) (*Palette, error) {
 	var err error
-	var packetCount int16
+	var packetCount uint16
 	err = binary.Read(f, binary.LittleEndian, &packetCount)
 	if err != nil {
 		return nil, fmt.Errorf("packetCount: %w", err)
 	}
-	skip := int8(0)
 
-	p := new(palette)
-	for i := int16(0); i < packetCount; i++ {
-		var skipAdd int8
-		err = binary.Read(f, binary.LittleEndian, &skipAdd)
+	p := pal.clone(pal.size())
+	index := 0
+	for i := uint16(0); i < packetCount; i++ {
+		var skip uint8
+		err = binary.Read(f, binary.LittleEndian, &skip)
 		if err != nil {
-			return nil, fmt.Errorf("skipAdd: %w", err)
+			return nil, fmt.Errorf("skip %d: %w", i, err)
 		}
-		skip += skipAdd
+		index += int(skip)
 
-		var sizeBuf int8
+		var sizeBuf uint8
 		err = binary.Read(f, binary.LittleEndian, &sizeBuf)
 		if err != nil {
 			return nil, fmt.Errorf("sizeBuf %d: %w", i, err)
 		}
-		var size int
-		if sizeBuf == 0 {
+		size := int(sizeBuf)
+		if size == 0 {
 			size = 256
-		} else {
-			size = int(sizeBuf)
 		}
-		for c := int(skip); c < int(skip)+size; c++ {
-			var r uint8
-			err = binary.Read(f, binary.LittleEndian, &r)
-			if err != nil {
-				return nil, fmt.Errorf("r %d: %w", i, err)
-			}
-			var g uint8
-			err = binary.Read(f, binary.LittleEndian, &g)
+		if index+size > p.Len() {
+			p = p.clone(index + size)
+		}
+		for c := 0; c < size; c++ {
+			var rgb [3]uint8
+			err = binary.Read(f, binary.LittleEndian, &rgb)
 			if err != nil {
-				return nil, fmt.Errorf("g %d: %w", i, err)
+				return nil, fmt.Errorf("rgb %d: %w", i, err)
 			}
-			var b uint8
-			err = binary.Read(f, binary.LittleEndian, &b)
-			if err != nil {
-				return nil, fmt.Errorf("b %d: %w", i, err)
+			if is6Bit {
+				for j := range rgb {
+					rgb[j] = rgb[j]<<2 | rgb[j]>>4
+				}
 			}
-			p.colors = append(p.colors, color.RGBA{R: r, G: g, B: b, A: 255})
+			p.Colors[index] = color.NRGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255}
+			p.Names[index] = ""
+			index++
 		}
 	}
 
@@ -3,24 +3,334 @@ package aseprite
 import (
 	"encoding/binary"
 	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
 	"io"
+	"math"
 )
 
+// ColorProfileType is the kind of color profile stored in a sprite
+type ColorProfileType uint16
+
+const (
+	// ColorProfileNone means colors are not tied to a color space, they are treated as sRGB
+	ColorProfileNone ColorProfileType = 0
+	// ColorProfileSRGB means colors are sRGB
+	ColorProfileSRGB ColorProfileType = 1
+	// ColorProfileICC means colors are described by an embedded ICC profile
+	ColorProfileICC ColorProfileType = 2
+)
+
+// ColorProfile represents the color profile chunk of a sprite
+type ColorProfile struct {
+	Type  ColorProfileType
+	Flags uint16
+	// Gamma is only used when HasGamma is true, 1.0 is linear
+	Gamma Fixed
+	// ICC holds the raw ICC profile when Type is ColorProfileICC
+	ICC []byte
+}
+
+// HasGamma returns true if the profile uses a fixed gamma instead of the sRGB curve
+func (cp *ColorProfile) HasGamma() bool {
+	return cp.Flags&1 == 1 //ASE_COLOR_PROFILE_FLAG_GAMMA
+}
+
+// IsSRGB returns true if colors need no conversion to be displayed as sRGB
+func (cp *ColorProfile) IsSRGB() bool {
+	return cp.Type != ColorProfileICC && !cp.HasGamma()
+}
+
+// ConvertToSRGB converts the colors of img from the profile to sRGB in place, e.g. the result of Sprite.RenderFrame.
+// Fixed gamma profiles and ICC profiles made of a matrix and tone curves are supported
+func (cp *ColorProfile) ConvertToSRGB(img draw.Image) error {
+	if cp.IsSRGB() {
+		return nil
+	}
+	cc, err := newColorConverter(cp)
+	if err != nil {
+		return err
+	}
+	if nrgba, ok := img.(*image.NRGBA); ok { //non-premultiplied pixels convert without losing precision
+		bounds := nrgba.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := nrgba.NRGBAAt(x, y)
+				if c.A == 0 {
+					continue
+				}
+				nrgba.SetNRGBA(x, y, cc.convert(c))
+			}
+		}
+		return nil
+	}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+			img.Set(x, y, cc.convert(c))
+		}
+	}
+	return nil
+}
+
+// convertPalette converts the colors of pal from the profile to sRGB in place
+func (cp *ColorProfile) convertPalette(pal color.Palette) error {
+	if cp.IsSRGB() {
+		return nil
+	}
+	cc, err := newColorConverter(cp)
+	if err != nil {
+		return err
+	}
+	for i, c := range pal {
+		nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+		if nc.A == 0 {
+			continue
+		}
+		pal[i] = cc.convert(nc)
+	}
+	return nil
+}
+
+// colorConverter converts colors of a profile to sRGB
+type colorConverter struct {
+	// curves turn each channel value into linear light
+	curves [3][256]float64
+	// matrix turns linear device rgb into linear sRGB
+	matrix [3][3]float64
+}
+
+// srgbColorants are the sRGB red, green and blue XYZ values adapted to the D50 white of ICC profiles
+var srgbColorants = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+func newColorConverter(cp *ColorProfile) (*colorConverter, error) {
+	cc := &colorConverter{}
+	if cp.Type != ColorProfileICC {
+		gamma := cp.Gamma.Float64()
+		for i := 0; i < 256; i++ {
+			value := math.Pow(float64(i)/255, gamma)
+			cc.curves[0][i] = value
+			cc.curves[1][i] = value
+			cc.curves[2][i] = value
+		}
+		cc.matrix = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+		return cc, nil
+	}
+
+	tags, err := readICCTags(cp.ICC)
+	if err != nil {
+		return nil, fmt.Errorf("icc: %w", err)
+	}
+	var colorants [3][3]float64
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		data, ok := tags[sig]
+		if !ok {
+			return nil, fmt.Errorf("icc: tag %s missing, only matrix/TRC profiles are supported", sig)
+		}
+		if len(data) < 20 || string(data[:4]) != "XYZ " {
+			return nil, fmt.Errorf("icc: tag %s is not XYZ", sig)
+		}
+		for j := 0; j < 3; j++ {
+			colorants[j][i] = float64(int32(binary.BigEndian.Uint32(data[8+j*4:]))) / 65536
+		}
+	}
+	for i, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		data, ok := tags[sig]
+		if !ok {
+			return nil, fmt.Errorf("icc: tag %s missing, only matrix/TRC profiles are supported", sig)
+		}
+		curve, err := readICCCurve(data)
+		if err != nil {
+			return nil, fmt.Errorf("icc: %s: %w", sig, err)
+		}
+		for j := 0; j < 256; j++ {
+			cc.curves[i][j] = curve(float64(j) / 255)
+		}
+	}
+	inverse, ok := invertMatrix(srgbColorants)
+	if !ok {
+		return nil, fmt.Errorf("srgb matrix is not invertible")
+	}
+	cc.matrix = multiplyMatrix(inverse, colorants)
+	return cc, nil
+}
+
+func (cc *colorConverter) convert(c color.NRGBA) color.NRGBA {
+	linear := [3]float64{cc.curves[0][c.R], cc.curves[1][c.G], cc.curves[2][c.B]}
+	var out [3]uint8
+	for i := 0; i < 3; i++ {
+		value := cc.matrix[i][0]*linear[0] + cc.matrix[i][1]*linear[1] + cc.matrix[i][2]*linear[2]
+		out[i] = uint8(math.Round(encodeSRGB(value) * 255))
+	}
+	return color.NRGBA{R: out[0], G: out[1], B: out[2], A: c.A}
+}
+
+// encodeSRGB applies the sRGB transfer function to linear light, clamping to 0-1
+func encodeSRGB(value float64) float64 {
+	if value <= 0 {
+		return 0
+	}
+	if value >= 1 {
+		return 1
+	}
+	if value <= 0.0031308 {
+		return value * 12.92
+	}
+	return 1.055*math.Pow(value, 1/2.4) - 0.055
+}
+
+// readICCTags returns the data of each tag of an ICC profile, keyed by signature
+func readICCTags(icc []byte) (map[string][]byte, error) {
+	if len(icc) < 132 {
+		return nil, fmt.Errorf("profile too short (%d bytes)", len(icc))
+	}
+	count := int(binary.BigEndian.Uint32(icc[128:]))
+	if len(icc) < 132+count*12 {
+		return nil, fmt.Errorf("tag table of %d tags out of bounds", count)
+	}
+	tags := make(map[string][]byte)
+	for i := 0; i < count; i++ {
+		entry := icc[132+i*12:]
+		offset := int(binary.BigEndian.Uint32(entry[4:]))
+		size := int(binary.BigEndian.Uint32(entry[8:]))
+		if offset < 0 || size < 0 || offset+size > len(icc) {
+			return nil, fmt.Errorf("tag %s out of bounds", entry[:4])
+		}
+		tags[string(entry[:4])] = icc[offset : offset+size]
+	}
+	return tags, nil
+}
+
+// readICCCurve returns the function of a curv or para tag, turning an encoded value into linear light
+func readICCCurve(data []byte) (func(x float64) float64, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("curve too short")
+	}
+	switch string(data[:4]) {
+	case "curv":
+		count := int(binary.BigEndian.Uint32(data[8:]))
+		if len(data) < 12+count*2 {
+			return nil, fmt.Errorf("curve of %d entries out of bounds", count)
+		}
+		switch count {
+		case 0:
+			return func(x float64) float64 { return x }, nil
+		case 1:
+			gamma := float64(binary.BigEndian.Uint16(data[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, gamma) }, nil
+		}
+		table := make([]float64, count)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(data[12+i*2:])) / 65535
+		}
+		return func(x float64) float64 {
+			pos := x * float64(count-1)
+			i := int(pos)
+			if i >= count-1 {
+				return table[count-1]
+			}
+			return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+		}, nil
+	case "para":
+		function := binary.BigEndian.Uint16(data[8:])
+		paramCounts := []int{1, 3, 4, 5, 7}
+		if int(function) >= len(paramCounts) {
+			return nil, fmt.Errorf("unknown parametric function %d", function)
+		}
+		if len(data) < 12+paramCounts[function]*4 {
+			return nil, fmt.Errorf("parametric curve out of bounds")
+		}
+		var p [7]float64
+		for i := 0; i < paramCounts[function]; i++ {
+			p[i] = float64(int32(binary.BigEndian.Uint32(data[12+i*4:]))) / 65536
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		switch function {
+		case 0:
+			return func(x float64) float64 { return math.Pow(x, g) }, nil
+		case 1:
+			return func(x float64) float64 {
+				if x >= -b/a {
+					return math.Pow(a*x+b, g)
+				}
+				return 0
+			}, nil
+		case 2:
+			return func(x float64) float64 {
+				if x >= -b/a {
+					return math.Pow(a*x+b, g) + c
+				}
+				return c
+			}, nil
+		case 3:
+			return func(x float64) float64 {
+				if x >= d {
+					return math.Pow(a*x+b, g)
+				}
+				return c * x
+			}, nil
+		}
+		return func(x float64) float64 {
+			if x >= d {
+				return math.Pow(a*x+b, g) + e
+			}
+			return c*x + f
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported curve type %q", data[:4])
+}
+
+func multiplyMatrix(a [3][3]float64, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			m[i][j] = a[i][0]*b[0][j] + a[i][1]*b[1][j] + a[i][2]*b[2][j]
+		}
+	}
+	return m
+}
+
+func invertMatrix(m [3][3]float64) ([3][3]float64, bool) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if det == 0 {
+		return m, false
+	}
+	var inv [3][3]float64
+	inv[0][0] = (m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det
+	inv[0][1] = (m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det
+	inv[0][2] = (m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det
+	inv[1][0] = (m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det
+	inv[1][1] = (m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det
+	inv[1][2] = (m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det
+	inv[2][0] = (m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det
+	inv[2][1] = (m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det
+	inv[2][2] = (m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det
+	return inv, true
+}
+
 func readColorProfile(f io.ReadSeeker, s *Sprite) error {
 	var err error
-
-	var profileType int16
-	err = binary.Read(f, binary.LittleEndian, &profileType)
+	cp := &ColorProfile{}
+	err = binary.Read(f, binary.LittleEndian, &cp.Type)
 	if err != nil {
 		return fmt.Errorf("profileType: %w", err)
 	}
-	var flags int16
-	err = binary.Read(f, binary.LittleEndian, &flags)
+	err = binary.Read(f, binary.LittleEndian, &cp.Flags)
 	if err != nil {
 		return fmt.Errorf("flags: %w", err)
 	}
-	var gamma int32
-	err = binary.Read(f, binary.LittleEndian, &gamma)
+	err = binary.Read(f, binary.LittleEndian, &cp.Gamma)
 	if err != nil {
 		return fmt.Errorf("gamma: %w", err)
 	}
@@ -29,20 +339,23 @@ func readColorProfile(f io.ReadSeeker, s *Sprite) error {
 	if err != nil {
 		return fmt.Errorf("colorProfile padding: %w", err)
 	}
-	switch profileType {
-	case 0: //ASE_FILE_NO_COLOR_PROFILE
-		if flags&1 == 1 { //ASE_COLOR_PROFILE_FLAG_GAMMA
-			return fmt.Errorf("color profiles not supported")
+	switch cp.Type {
+	case ColorProfileNone: //ASE_FILE_NO_COLOR_PROFILE
+	case ColorProfileSRGB: //ASE_FILE_SRGB_COLOR_PROFILE
+	case ColorProfileICC: //ASE_FILE_ICC_COLOR_PROFILE
+		var length uint32
+		err = binary.Read(f, binary.LittleEndian, &length)
+		if err != nil {
+			return fmt.Errorf("icc length: %w", err)
 		}
-	case 1: //ASE_FILE_SRGB_COLOR_PROFILE
-	case 2: //ASE_FILE_ICC_COLOR_PROFILE
-		_, err = f.Seek(4, 1)
+		cp.ICC = make([]byte, length)
+		_, err = io.ReadFull(f, cp.ICC)
 		if err != nil {
-			return fmt.Errorf("seek colorProfile: %w", err)
+			return fmt.Errorf("icc: %w", err)
 		}
 	default:
-		return fmt.Errorf("profileType %d not supported", profileType)
+		return fmt.Errorf("profileType %d not supported", cp.Type)
 	}
-	s.colorSpace = 0
+	s.ColorProfile = cp
 	return nil
 }
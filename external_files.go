@@ -0,0 +1,201 @@
+package aseprite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExternalFileType is the kind of an external file entry
+type ExternalFileType uint8
+
+const (
+	// ExternalPalette refers to a palette file
+	ExternalPalette ExternalFileType = 0
+	// ExternalTileset refers to a file holding tilesets
+	ExternalTileset ExternalFileType = 1
+	// ExternalPropertiesExtension is the id of the extension owning a user data properties map
+	ExternalPropertiesExtension ExternalFileType = 2
+	// ExternalTileManagementExtension is the id of the extension managing tiles
+	ExternalTileManagementExtension ExternalFileType = 3
+)
+
+// ExternalFile is an entry of the external files chunk
+type ExternalFile struct {
+	ID   uint32
+	Type ExternalFileType
+	// Name is the file name, or the extension id for extension entries
+	Name string
+	// Sprite is the decoded file, set by ResolveExternalFiles for palettes and tilesets
+	Sprite *Sprite
+	// Palette is the palette of Sprite, set by ResolveExternalFiles for palette entries
+	Palette *Palette
+}
+
+// ExternalResolver opens the external file stored as name in the sprite
+type ExternalResolver func(name string) (io.ReadSeeker, error)
+
+// DirResolver opens external files relative to dir on disk, usually the directory of the sprite.
+// Backslashes in names are treated as separators, as files saved on Windows use them
+func DirResolver(dir string) ExternalResolver {
+	return func(name string) (io.ReadSeeker, error) {
+		name = filepath.FromSlash(strings.ReplaceAll(name, "\\", "/"))
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	}
+}
+
+// FSResolver opens external files from fsys, names are cleaned and use forward slashes
+func FSResolver(fsys fs.FS) ExternalResolver {
+	return func(name string) (io.ReadSeeker, error) {
+		name = strings.TrimPrefix(path.Clean(strings.ReplaceAll(name, "\\", "/")), "/")
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	}
+}
+
+// ExternalFile returns the external file entry with provided id, or nil if it doesn't exist
+func (s *Sprite) ExternalFile(id uint32) *ExternalFile {
+	for _, ef := range s.ExternalFiles {
+		if ef.ID == id {
+			return ef
+		}
+	}
+	return nil
+}
+
+// ExternalPalette returns the resolved palette of the external file with provided id,
+// or nil if it's not a palette or ResolveExternalFiles wasn't called
+func (s *Sprite) ExternalPalette(id uint32) *Palette {
+	ef := s.ExternalFile(id)
+	if ef == nil {
+		return nil
+	}
+	return ef.Palette
+}
+
+// ExtensionProperties returns the properties map of ud owned by the extension with provided id
+func (s *Sprite) ExtensionProperties(ud *UserData, extension string) PropertyMap {
+	for _, ef := range s.ExternalFiles {
+		if ef.Type == ExternalPropertiesExtension && ef.Name == extension {
+			return ud.Properties[ef.ID]
+		}
+	}
+	return nil
+}
+
+// ResolveExternalFiles decodes external palettes and tilesets with resolve, which must return aseprite files.
+// External palettes are available from ExternalPalette, tiles of external tilesets are copied into the sprite's tilesets,
+// and tilemap cels using them are drawn again
+func (s *Sprite) ResolveExternalFiles(resolve ExternalResolver) error {
+	for _, ef := range s.ExternalFiles {
+		if ef.Type != ExternalPalette && ef.Type != ExternalTileset {
+			continue
+		}
+		r, err := resolve(ef.Name)
+		if err != nil {
+			return fmt.Errorf("open %s: %w", ef.Name, err)
+		}
+		ef.Sprite, err = Decode(r)
+		if closer, ok := r.(io.Closer); ok {
+			closer.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("decode %s: %w", ef.Name, err)
+		}
+		if ef.Type == ExternalPalette {
+			ef.Palette = ef.Sprite.Palette
+		}
+	}
+
+	for _, ts := range s.Tilesets {
+		if !ts.IsExternal() {
+			continue
+		}
+		ef := s.ExternalFile(ts.ExternalFileID)
+		if ef == nil || ef.Sprite == nil {
+			return fmt.Errorf("tileset %d: external file %d not found", ts.ID, ts.ExternalFileID)
+		}
+		src := ef.Sprite.Tileset(ts.ExternalTilesetID)
+		if src == nil {
+			return fmt.Errorf("tileset %d: tileset %d not found in %s", ts.ID, ts.ExternalTilesetID, ef.Name)
+		}
+		ts.TileCount = src.TileCount
+		ts.TileWidth = src.TileWidth
+		ts.TileHeight = src.TileHeight
+		ts.Tiles = src.Tiles
+		ts.tileIndexes = src.tileIndexes
+	}
+
+	for _, layer := range s.coreLayers {
+		for _, c := range layer.Cells {
+			if c.Tilemap != nil && c.Tilemap.Tileset != nil && c.Tilemap.Tileset.IsExternal() {
+				c.Image = c.Tilemap.image()
+				c.indexes = c.Tilemap.indexes(int(s.transparentIndex))
+			}
+		}
+	}
+	return nil
+}
+
+// LoadWithExternalFiles loads a sprite and resolves its external files relative to its directory
+func LoadWithExternalFiles(path string) (*Sprite, error) {
+	s, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	err = s.ResolveExternalFiles(DirResolver(filepath.Dir(path)))
+	if err != nil {
+		return nil, fmt.Errorf("resolve: %w", err)
+	}
+	return s, nil
+}
+
+func readExternalFilesChunk(f io.ReadSeeker, s *Sprite) error {
+	var err error
+	var entryCount uint32
+	err = binary.Read(f, binary.LittleEndian, &entryCount)
+	if err != nil {
+		return fmt.Errorf("entryCount: %w", err)
+	}
+	_, err = f.Seek(8, 1)
+	if err != nil {
+		return fmt.Errorf("seek entries: %w", err)
+	}
+	for i := uint32(0); i < entryCount; i++ {
+		ef := new(ExternalFile)
+		err = binary.Read(f, binary.LittleEndian, &ef.ID)
+		if err != nil {
+			return fmt.Errorf("id %d: %w", i, err)
+		}
+		err = binary.Read(f, binary.LittleEndian, &ef.Type)
+		if err != nil {
+			return fmt.Errorf("type %d: %w", i, err)
+		}
+		_, err = f.Seek(7, 1)
+		if err != nil {
+			return fmt.Errorf("seek name %d: %w", i, err)
+		}
+		ef.Name, err = readString(f)
+		if err != nil {
+			return fmt.Errorf("name %d: %w", i, err)
+		}
+		s.ExternalFiles = append(s.ExternalFiles, ef)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package aseprite
+
+// Fixed is a 16.16 fixed point number
+type Fixed int32
+
+// Float64 returns the fixed point number as a float
+func (f Fixed) Float64() float64 {
+	return float64(f) / 65536
+}
+
+// Int returns the integer part of the fixed point number, rounded towards negative infinity
+func (f Fixed) Int() int {
+	return int(f >> 16)
+}
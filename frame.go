@@ -0,0 +1,63 @@
+package aseprite
+
+import (
+	"sort"
+	"time"
+)
+
+// Frame represents a single frame of the sprite animation
+type Frame struct {
+	Index    int
+	Duration time.Duration
+	// Cels holds the cels of the frame in layer order, from bottom to top. Empty layers are skipped
+	Cels []*Cell
+}
+
+// newFrame collects the cels of frameIndex once all of its chunks are read
+func newFrame(s *Sprite, frameIndex uint16, duration uint16) *Frame {
+	frame := &Frame{
+		Index:    int(frameIndex),
+		Duration: time.Duration(duration) * time.Millisecond,
+		Cels:     []*Cell{},
+	}
+	for _, layer := range s.coreLayers {
+		c := layer.CelAt(int(frameIndex))
+		if c != nil {
+			frame.Cels = append(frame.Cels, c)
+		}
+	}
+	return frame
+}
+
+// OrderedCels returns the cels of the frame in the order they are composited, from bottom to top.
+// Like aseprite, a cel is placed at its layer index plus its z-index, ties put the lowest z-index first
+func (f *Frame) OrderedCels() []*Cell {
+	cels := make([]*Cell, len(f.Cels))
+	copy(cels, f.Cels)
+	sort.SliceStable(cels, func(i, j int) bool {
+		a := cels[i].layer.index + int(cels[i].ZIndex)
+		b := cels[j].layer.index + int(cels[j].ZIndex)
+		if a != b {
+			return a < b
+		}
+		return cels[i].ZIndex < cels[j].ZIndex
+	})
+	return cels
+}
+
+// Frame returns the frame at frameIndex, or nil if it's out of range
+func (s *Sprite) Frame(frameIndex int) *Frame {
+	if frameIndex < 0 || frameIndex >= len(s.Frames) {
+		return nil
+	}
+	return s.Frames[frameIndex]
+}
+
+// Duration returns the total duration of the animation
+func (s *Sprite) Duration() time.Duration {
+	total := time.Duration(0)
+	for _, frame := range s.Frames {
+		total += frame.Duration
+	}
+	return total
+}
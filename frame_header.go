@@ -16,7 +16,7 @@ type frameHeader struct {
 	duration   uint16
 }
 
-func readFrameHeader(f io.ReadSeeker, frameIndex uint16, flags uint32, isIgnoreOldColorChunks bool, s *Sprite) error {
+func readFrameHeader(f io.ReadSeeker, frameIndex uint16, flags uint32, isIgnoreOldColorChunks *bool, s *Sprite) error {
 	// log := log.New()
 	// log.Debug().Msgf("----- frame %d -----", frameIndex)
 	var err error
@@ -25,9 +25,13 @@ func readFrameHeader(f io.ReadSeeker, frameIndex uint16, flags uint32, isIgnoreO
 		return fmt.Errorf("file must not be nil")
 	}
 
-	lastLayer := &Layer{
-		UserData: &UserData{},
+	//each frame starts with the palette of the previous one
+	var pal *Palette
+	if frameIndex > 0 {
+		pal = s.palettes[frameIndex-1]
 	}
+	s.palettes = append(s.palettes, pal)
+
 	err = binary.Read(f, binary.LittleEndian, &h.size)
 	if err != nil {
 		return fmt.Errorf("size: %w", err)
@@ -54,6 +58,9 @@ func readFrameHeader(f io.ReadSeeker, frameIndex uint16, flags uint32, isIgnoreO
 	if err != nil {
 		return fmt.Errorf("nchunks: %w", err)
 	}
+	if h.duration == 0 { //frames without duration fall back to the deprecated header speed
+		h.duration = s.speed
+	}
 	if h.chunkCount == 0xFFFF && h.chunkCount < uint16(nchunks) {
 		h.chunkCount = uint16(nchunks)
 	}
@@ -66,11 +73,9 @@ func readFrameHeader(f io.ReadSeeker, frameIndex uint16, flags uint32, isIgnoreO
 		return h, nil
 	}*/
 
-	var prevLayer *Layer
-	var currentLevel int16
 	var lastCel *Cell
-	var lastSlice *Slice
-	var pal *palette
+	//user data chunks are assigned in order to the targets of the chunk owning them
+	var userDataTargets []*UserData
 	var chunkSize uint32
 	var chunkStart int64
 	// log.Debug().Msgf("processing %d chunks for frame %d", h.chunkCount, frameIndex)
@@ -97,29 +102,41 @@ func readFrameHeader(f io.ReadSeeker, frameIndex uint16, flags uint32, isIgnoreO
 		if err != nil {
 			return fmt.Errorf("chunkType %d: %w", chunkIndex, err)
 		}
+		//chunks owning user data replace the targets, cel extra chunks may sit between a cel and its user data,
+		//any other chunk ends the user data of the previous one
+		if chunkType != 0x2020 && chunkType != 0x2006 { //ASE_FILE_CHUNK_USER_DATA, ASE_FILE_CHUNK_CEL_EXTRA
+			userDataTargets = nil
+		}
 		switch chunkType {
-		case 11, 4: //ASE_FILE_CHUNK_FLI_COLOR, ASE_FILE_CHUNK_FLI_COLOR2 legacy
-
-			if isIgnoreOldColorChunks {
+		case 0x0004, 0x0011: //ASE_FILE_CHUNK_FLI_COLOR2, ASE_FILE_CHUNK_FLI_COLOR legacy
+			if frameIndex == 0 {
+				userDataTargets = []*UserData{s.UserData}
+			}
+			if *isIgnoreOldColorChunks {
 				// log.Debug().Msgf("ignoreOldChunks enabled, skipping %d", chunkType)
 				continue
 			}
 			// log.Debug().Msgf("readColorChunk 0x%x", pos)
-			pal, err = readColorChunk(f)
+			s.palettes[frameIndex], err = readColorChunk(f, s.palettes[frameIndex], chunkType == 0x0011)
 			if err != nil {
 				return fmt.Errorf("readColorChunk %d: %w", chunkIndex, err)
 			}
 			// log.Debug().Msgf("colorChunk palette %v", pal)
 		case 0x2019: //ASE_FILE_CHUNK_PALETTE
 			// log.Debug().Msgf("readPaletteChunk 0x%x", pos)
-			_, err = readPaletteChunk(f, frameIndex, flags)
+			s.palettes[frameIndex], err = readPaletteChunk(f, s.palettes[frameIndex])
 			if err != nil {
 				return fmt.Errorf("readPalleteChunk %d: %w", chunkIndex, err)
 			}
+			//files with the new palette chunk keep the old ones only for compatibility
+			*isIgnoreOldColorChunks = true
+			if frameIndex == 0 {
+				userDataTargets = []*UserData{s.UserData}
+			}
 			// log.Debug().Msgf("palette %v", pal)
 		case 0x2004: //ASE_FILE_CHUNK_LAYER
 			// log.Debug().Msgf("readLayerChunk 0x%x", pos)
-			layer, err := readLayerChunk(f, s, flags, prevLayer, currentLevel)
+			layer, err := readLayerChunk(f, s, flags)
 			if err != nil {
 				return fmt.Errorf("readLayerChunk %d: %w", chunkIndex, err)
 			}
@@ -127,20 +144,18 @@ func readFrameHeader(f io.ReadSeeker, frameIndex uint16, flags uint32, isIgnoreO
 			if layer != nil {
 				s.coreLayers = append(s.coreLayers, layer)
 				s.Layers[strings.ToLower(layer.Name)] = layer
-				lastLayer = layer
-				lastSlice = nil
+				userDataTargets = []*UserData{layer.UserData}
 				lastCel = nil
 			}
 		case 0x2005: //ASE_FILE_CHUNK_CEL
 			//log.Debug().Msgf("readCelChunk 0x%x", pos)
-			cel, err := readCellChunk(f, s.coreLayers, frameIndex, chunkSize, pal, h.duration)
+			cel, err := readCellChunk(f, s, frameIndex, h.duration)
 			if err != nil {
 				return fmt.Errorf("readCelChunk %d: %w", chunkIndex, err)
 			}
 			if cel != nil {
 				lastCel = cel
-				lastLayer = nil
-				lastSlice = nil
+				userDataTargets = []*UserData{cel.UserData}
 			}
 		case 0x2006: //ASE_FILE_CHUNK_CEL_EXTRA
 			if lastCel == nil {
@@ -158,40 +173,48 @@ func readFrameHeader(f io.ReadSeeker, frameIndex uint16, flags uint32, isIgnoreO
 			if err != nil {
 				return fmt.Errorf("readColorProfile %d: %w", chunkIndex, err)
 			}
+		case 0x2008: //ASE_FILE_CHUNK_EXTERNAL_FILE
+			// log.Debug().Msgf("readExternalFilesChunk 0x%x", pos)
+			err = readExternalFilesChunk(f, s)
+			if err != nil {
+				return fmt.Errorf("readExternalFilesChunk %d: %w", chunkIndex, err)
+			}
 		case 0x2016: //ASE_FILE_CHUNK_MASK
 			// log.Debug().Msgf("readMaskChunk 0x%x", pos)
 			mask, err := readMaskChunk(f)
 			if err != nil {
 				return fmt.Errorf("readMaskChunk %d: %w", chunkIndex, err)
 			}
-			if mask != nil {
-				fmt.Println("mask", mask)
-			}
+			s.Masks = append(s.Masks, mask)
 		case 0x2017: //ASE_FILE_CHUNK_PATH
 			// log.Debug().Msgf("ignoring chunk path 0x%x", pos)
 			//ignore
 		case 0x2018: //ASE_FILE_CHUNK_TAGS
 			// log.Debug().Msgf("readTagChunk 0x%x", pos)
+			tagCount := len(s.Tags)
 			err = readTagChunk(f, s)
 			if err != nil {
 				return fmt.Errorf("readTagsChunk %d: %w", chunkIndex, err)
 			}
+			userDataTargets = make([]*UserData, 0, len(s.Tags)-tagCount)
+			for _, t := range s.Tags[tagCount:] {
+				userDataTargets = append(userDataTargets, t.UserData)
+			}
 		case 0x2021: //ASE_FILE_CHUNK_SLICES
 			// log.Debug().Msgf("readSlicesChunk 0x%x", pos)
-			err = readSlicesChunk(f, frameIndex, s)
+			err = readSlicesChunk(f, s)
 			if err != nil {
 				return fmt.Errorf("readSlicesChunk %d: %w", chunkIndex, err)
 			}
 		case 0x2022: //ASE_FILE_CHUNK_SLICE
 			// log.Debug().Msgf("readSliceChunk 0x%x", pos)
-			sl, err := readSliceChunk(f, frameIndex, s)
+			sl, err := readSliceChunk(f, s)
 			if err != nil {
 				return fmt.Errorf("readSliceChunk %d: %w", chunkIndex, err)
 			}
 			if sl != nil {
 				lastCel = nil
-				lastLayer = nil
-				lastSlice = sl
+				userDataTargets = []*UserData{sl.UserData}
 			}
 		case 0x2020: //ASE_FILE_CHUNK_USER_DATA
 			// log.Debug().Msgf("readUserDataChunk 0x%x", pos)
@@ -199,30 +222,19 @@ func readFrameHeader(f io.ReadSeeker, frameIndex uint16, flags uint32, isIgnoreO
 			if err != nil {
 				return fmt.Errorf("readUserDataChunk %d: %w", chunkIndex, err)
 			}
-			if lastCel != nil {
-				lastCel.UserData = &ud
-			}
-			if lastLayer != nil {
-				lastLayer.UserData = &ud
-			}
-			if lastSlice != nil {
-				lastSlice.UserData = &ud
+			if len(userDataTargets) > 0 {
+				*userDataTargets[0] = ud
+				userDataTargets = userDataTargets[1:]
 			}
 		case 0x2023: //ASE_FILE_CHUNK_TILESET
-			//log.Debug().Msgf("readFrameHeader: ignoring chunk tileset %d 0x%x", chunkType, chunkIndex)
-			layer, err := readLayerChunk(f, s, flags, prevLayer, currentLevel)
+			// log.Debug().Msgf("readTilesetChunk 0x%x", pos)
+			ts, err := readTilesetChunk(f, s, s.palettes[frameIndex])
 			if err != nil {
-				return fmt.Errorf("readLayerChunk Tileset %d: %w", chunkIndex, err)
+				return fmt.Errorf("readTilesetChunk %d: %w", chunkIndex, err)
 			}
-
-			if layer != nil {
-				s.coreLayers = append(s.coreLayers, layer)
-				s.Layers[strings.ToLower(layer.Name)] = layer
-				lastLayer = layer
-				lastSlice = nil
-				lastCel = nil
-			}
-			//ignore
+			s.Tilesets = append(s.Tilesets, ts)
+			lastCel = nil
+			userDataTargets = append([]*UserData{ts.UserData}, ts.TileUserData...)
 		default:
 			log.Warn().Msgf("unknown chunk type %d at index %d", chunkType, chunkIndex)
 			//log.Warn().Uint32("chunkSize", chunkSize).Msgf("readFrameHeader: unhandled chunk type %d at index %d 0x%x", chunkType, chunkIndex, pos)
@@ -234,6 +246,7 @@ func readFrameHeader(f io.ReadSeeker, frameIndex uint16, flags uint32, isIgnoreO
 			return fmt.Errorf("reposition")
 		}
 	}
+	s.Frames = append(s.Frames, newFrame(s, frameIndex, h.duration))
 
 	return nil
 }
@@ -1,164 +1,143 @@
 package aseprite
 
 import (
-	"bytes"
 	"compress/zlib"
-	"encoding/binary"
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"io"
 )
 
-func readRawImage(f io.ReadSeeker, pixelFormat int, width int16, height int16, pal *palette) (*image.RGBA, error) {
-	var err error
-	img := new(image.RGBA)
-	var r uint8
-	var g uint8
-	var b uint8
-	var a uint8
-	for y := 0; y < int(height); y++ {
-		for x := 0; x < int(width); x++ {
-			switch pixelFormat {
-			case pixelFormatIMAGERGB:
-				err = binary.Read(f, binary.LittleEndian, &r)
-				if err != nil {
-					return nil, fmt.Errorf("r: %w", err)
-				}
-				err = binary.Read(f, binary.LittleEndian, &g)
-				if err != nil {
-					return nil, fmt.Errorf("g: %w", err)
-				}
-				err = binary.Read(f, binary.LittleEndian, &b)
-				if err != nil {
-					return nil, fmt.Errorf("b: %w", err)
-				}
-				err = binary.Read(f, binary.LittleEndian, &a)
-				if err != nil {
-					return nil, fmt.Errorf("a: %w", err)
-				}
-				img.Set(x, y, color.RGBA{R: r, G: g, B: b, A: a})
-			case pixelFormatIMAGEGRAYSCALE:
-				err = binary.Read(f, binary.LittleEndian, &r)
-				if err != nil {
-					return nil, fmt.Errorf("k: %w", err)
-				}
-				err = binary.Read(f, binary.LittleEndian, &a)
-				if err != nil {
-					return nil, fmt.Errorf("a: %w", err)
-				}
-				img.Set(x, y, color.RGBA{R: r, G: r, B: r, A: a})
-			case pixelFormatIMAGEINDEXED:
-				err = binary.Read(f, binary.LittleEndian, &r)
-				if err != nil {
-					return nil, fmt.Errorf("index: %w", err)
-				}
-				if int(r) >= len(pal.colors) {
-					return nil, fmt.Errorf("index %d out of range for palette (%d)", r, len(pal.colors))
-				}
-				color := pal.colors[int(r)]
-				img.Set(x, y, color)
-			default:
-				return nil, fmt.Errorf("unknown pixel format %d", pixelFormat)
-			}
-		}
+// pixelFormatFromDepth returns the pixel format used by cels of a sprite with the provided color depth
+func pixelFormatFromDepth(depth uint16) int {
+	switch depth {
+	case 32:
+		return pixelFormatIMAGERGB
+	case 16:
+		return pixelFormatIMAGEGRAYSCALE
+	case 8:
+		return pixelFormatIMAGEINDEXED
 	}
-	return img, nil
+	return pixelFormatNone
+}
+
+// bytesPerPixel returns how many bytes a single pixel of pixelFormat takes
+func bytesPerPixel(pixelFormat int) int {
+	switch pixelFormat {
+	case pixelFormatIMAGERGB:
+		return 4
+	case pixelFormatIMAGEGRAYSCALE:
+		return 2
+	case pixelFormatIMAGEINDEXED:
+		return 1
+	}
+	return 0
 }
 
-func readCompressedImage(f io.ReadSeeker, pixelFormat int, width int16, height int16, chunkSize uint32, pal *palette) (*image.RGBA, error) {
-	// log := log.New().With().Int16("width", width).Int16("height", height).Logger()
-	var err error
-	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+// readRawImage reads an uncompressed image. transparentIndex is the palette entry treated as
+// fully transparent for indexed images, or -1 if every entry is opaque.
+// Indexed images are also returned as an image.Paletted keeping the palette indices, which is nil for other formats
+func readRawImage(f io.Reader, pixelFormat int, width int, height int, pal *Palette, transparentIndex int) (*image.NRGBA, *image.Paletted, error) {
+	bpp := bytesPerPixel(pixelFormat)
+	if bpp == 0 {
+		return nil, nil, fmt.Errorf("unknown pixel format %d", pixelFormat)
+	}
+	data := make([]byte, width*height*bpp)
+	_, err := io.ReadFull(f, data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read: %w", err)
+	}
+	img, err := decodePixels(data, pixelFormat, width, height, pal, transparentIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pixelFormat != pixelFormatIMAGEINDEXED {
+		return img, nil, nil
+	}
+	indexes := image.NewPaletted(image.Rect(0, 0, width, height), pal.colorPalette())
+	copy(indexes.Pix, data)
+	return img, indexes, nil
+}
 
+// readCompressedImage reads a zlib compressed image. transparentIndex is the palette entry treated as
+// fully transparent for indexed images, or -1 if every entry is opaque
+func readCompressedImage(f io.Reader, pixelFormat int, width int, height int, pal *Palette, transparentIndex int) (*image.NRGBA, *image.Paletted, error) {
 	zr, err := zlib.NewReader(f)
 	if err != nil {
-		return nil, fmt.Errorf("zlib: %w", err)
+		return nil, nil, fmt.Errorf("zlib: %w", err)
 	}
 	defer zr.Close()
 
-	data := make([]byte, chunkSize)
-
-	buf := bytes.NewBuffer(data)
-
-	// log.Debug().Msg("parsing")
-	_, err = io.Copy(buf, zr)
+	img, indexes, err := readRawImage(zr, pixelFormat, width, height, pal, transparentIndex)
 	if err != nil {
-		return nil, fmt.Errorf("copy: %w", err)
+		return nil, nil, fmt.Errorf("%dx%d: %w", width, height, err)
 	}
+	return img, indexes, nil
+}
 
-	//16x12 = 192
-	//raw 0's: 101
-	//16x16 = 256
-	//raw 0's: 79
-
-	data = buf.Bytes()
-
-	br := bytes.NewReader(data[chunkSize:])
-	//buf = bytes.NewBuffer(data)
-	//fmt.Println(fmt.Sprintf("%d %dx%d %x", pixelFormat, width, height, buf))
-
-	var r uint8
-	var g uint8
-	var b uint8
-	var a uint8
+// decodePixels converts pixel data of pixelFormat into a non-premultiplied image, keeping the stored values as they are
+func decodePixels(data []byte, pixelFormat int, width int, height int, pal *Palette, transparentIndex int) (*image.NRGBA, error) {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	bpp := bytesPerPixel(pixelFormat)
+	if bpp == 0 {
+		return nil, fmt.Errorf("unknown pixel format %d", pixelFormat)
+	}
+	if len(data) < width*height*bpp {
+		return nil, fmt.Errorf("expected %d bytes of pixel data, got %d", width*height*bpp, len(data))
+	}
+	if pixelFormat == pixelFormatIMAGEINDEXED && pal == nil {
+		return nil, fmt.Errorf("indexed image without a palette")
+	}
 
-	for y := 0; y < int(height); y++ {
-		for x := 0; x < int(width); x++ {
+	pos := 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
 			switch pixelFormat {
 			case pixelFormatIMAGERGB:
-				err = binary.Read(br, binary.LittleEndian, &r)
-				if err != nil {
-					return nil, fmt.Errorf("%dx%d, r: %w", x, y, err)
-				}
-				err = binary.Read(br, binary.LittleEndian, &g)
-				if err != nil {
-					return nil, fmt.Errorf("g: %w", err)
-				}
-				err = binary.Read(br, binary.LittleEndian, &b)
-				if err != nil {
-					return nil, fmt.Errorf("b: %w", err)
-				}
-				err = binary.Read(br, binary.LittleEndian, &a)
-				if err != nil {
-					return nil, fmt.Errorf("a: %w", err)
-				}
-				img.Set(x, y, color.RGBA{R: r, G: g, B: b, A: a})
+				img.SetNRGBA(x, y, color.NRGBA{R: data[pos], G: data[pos+1], B: data[pos+2], A: data[pos+3]})
 			case pixelFormatIMAGEGRAYSCALE:
-				err = binary.Read(br, binary.LittleEndian, &r)
-				if err != nil {
-					return nil, fmt.Errorf("k: %w", err)
-				}
-				err = binary.Read(br, binary.LittleEndian, &a)
-				if err != nil {
-					return nil, fmt.Errorf("a: %w", err)
-				}
-				img.Set(x, y, color.RGBA{R: r, G: r, B: r, A: a})
+				img.SetNRGBA(x, y, color.NRGBA{R: data[pos], G: data[pos], B: data[pos], A: data[pos+1]})
 			case pixelFormatIMAGEINDEXED:
-				err = binary.Read(br, binary.LittleEndian, &r)
-				if err != nil {
-					return nil, fmt.Errorf("index: %w", err)
+				index := int(data[pos])
+				if index == transparentIndex {
+					break
 				}
-				if int(r) >= len(pal.colors) {
-					return nil, fmt.Errorf("index %d out of range for palette (%d)", r, len(pal.colors))
+				if index >= len(pal.Colors) {
+					return nil, fmt.Errorf("index %d out of range for palette (%d)", index, len(pal.Colors))
 				}
-				color := pal.colors[int(r)]
-				img.Set(x, y, color)
-			default:
-				return nil, fmt.Errorf("unknown pixel format %d", pixelFormat)
+				img.SetNRGBA(x, y, pal.Colors[index])
 			}
+			pos += bpp
 		}
 	}
-
 	return img, nil
 }
 
-func convertImage(src *image.RGBA, width uint16, height uint16, positionX int16, positionY int16) *image.RGBA {
-	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
-	for y := int16(0); y < int16(height); y++ {
-		for x := int16(0); x < int16(width); x++ {
-			img.SetRGBA(int(x+positionX), int(y+positionY), src.RGBAAt(int(x), int(y)))
-		}
+// cropImage copies the bounds area of src into a new image with its origin at 0, 0
+func cropImage(src *image.NRGBA, bounds image.Rectangle) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		copy(img.Pix[y*img.Stride:(y+1)*img.Stride], src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y+y):])
+	}
+	return img
+}
+
+// cropPaletted copies the bounds area of src into a new image with its origin at 0, 0
+func cropPaletted(src *image.Paletted, bounds image.Rectangle) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), src.Palette)
+	for y := 0; y < bounds.Dy(); y++ {
+		copy(img.Pix[y*img.Stride:(y+1)*img.Stride], src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y+y):])
+	}
+	return img
+}
+
+// convertImage copies src at positionX, positionY into an image of width and height, clipping anything outside
+func convertImage(src *image.NRGBA, width uint16, height uint16, positionX int16, positionY int16) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, int(width), int(height)))
+	if src == nil {
+		return img
 	}
+	draw.Draw(img, src.Bounds().Sub(src.Bounds().Min).Add(image.Pt(int(positionX), int(positionY))), src, src.Bounds().Min, draw.Src)
 	return img
 }
@@ -4,21 +4,29 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"strings"
 )
 
 // Layer represents layers of a sprite
 type Layer struct {
 	isImage      bool
 	isTileset    bool
+	isGroup      bool
 	SpriteWidth  uint16
 	SpriteHeight uint16
 	BlendMode    int16
 	Name         string
 	Opacity      int8
 	Flags        int16
-	parents      []*Layer
-	layers       []*Layer
-	Cells        []*Cell
+	index        int
+	childLevel   int16
+	opacity      uint8 // opacity applied when rendering, 255 when the file doesn't store a valid one
+	parent       *Layer
+	children     []*Layer
+	Cells        []*Cell // cels in frame order, frames without a cel are skipped
+	cels         map[uint16]*Cell
+	TilesetIndex uint32 // id of the tileset used by tilemap layers
+	UUID         UUID   // only set when the file stores layer uuids
 	UserData     *UserData
 }
 
@@ -53,13 +61,15 @@ const (
 	blendModeDivide        int16 = 18
 )
 
-func readLayerChunk(f io.ReadSeeker, s *Sprite, headerFlags uint32, prevLayer *Layer, currentLevel int16) (*Layer, error) {
+func readLayerChunk(f io.ReadSeeker, s *Sprite, headerFlags uint32) (*Layer, error) {
 	// log := log.New()
 	var err error
 	layer := &Layer{
 		UserData:     &UserData{},
 		SpriteWidth:  s.Width,
 		SpriteHeight: s.Height,
+		opacity:      255,
+		index:        len(s.coreLayers),
 	}
 
 	var flags int16
@@ -108,27 +118,237 @@ func readLayerChunk(f io.ReadSeeker, s *Sprite, headerFlags uint32, prevLayer *L
 			layer.BlendMode = blendMode
 			if headerFlags&1 == 1 { //ASE_FILE_FLAG_LAYER_WITH_OPACITY
 				layer.Opacity = opacity
+				layer.opacity = uint8(opacity)
 			}
 		}
 	case 1: //ASE_FILE_LAYER_GROUP
+		layer.isGroup = true
+		if headerFlags&2 == 2 { //ASE_FILE_FLAG_COMPOSITE_GROUPS
+			layer.BlendMode = blendMode
+			if headerFlags&1 == 1 { //ASE_FILE_FLAG_LAYER_WITH_OPACITY
+				layer.Opacity = opacity
+				layer.opacity = uint8(opacity)
+			}
+		}
 	case 2: //ASE_FILE_LAYER_TILESET
 		layer.isTileset = true
-		//layer.TileSetIndex =
-	default:
-		return nil, nil
+		layer.BlendMode = blendMode
+		if headerFlags&1 == 1 { //ASE_FILE_FLAG_LAYER_WITH_OPACITY
+			layer.Opacity = opacity
+			layer.opacity = uint8(opacity)
+		}
+		err = binary.Read(f, binary.LittleEndian, &layer.TilesetIndex)
+		if err != nil {
+			return nil, fmt.Errorf("tilesetIndex: %w", err)
+		}
+	default: //unknown layers are kept so cels still refer to the right layer index
+	}
+	if headerFlags&4 == 4 { //ASE_FILE_FLAG_LAYER_WITH_UUID
+		err = binary.Read(f, binary.LittleEndian, &layer.UUID)
+		if err != nil {
+			return nil, fmt.Errorf("uuid: %w", err)
+		}
 	}
 
 	layer.Flags = flags
 	layer.Name = name
-	if prevLayer != nil {
-		if childLevel == currentLevel {
-			prevLayer.parents = append(prevLayer.parents, layer)
-		} else if childLevel > currentLevel {
-			prevLayer.layers = append(prevLayer.layers, layer)
-		} else { //if childLevel < currentLevel {
-			layer.parents = append(layer.parents, prevLayer)
+	layer.childLevel = childLevel
+	//the parent is the closest previous group one level above
+	for i := len(s.coreLayers) - 1; i >= 0 && childLevel > 0; i-- {
+		prev := s.coreLayers[i]
+		if prev.childLevel >= childLevel {
+			continue
+		}
+		if prev.childLevel == childLevel-1 && prev.isGroup {
+			layer.parent = prev
+			prev.children = append(prev.children, layer)
 		}
+		break
 	}
 	// log.Debug().Msgf("layer: %v", layer)
 	return layer, nil
 }
+
+// Visible returns true if the layer is visible, ignoring its parent groups
+func (l *Layer) Visible() bool {
+	return l.Flags&1 == 1 //ASE_LAYER_FLAG_VISIBLE
+}
+
+// Editable returns true if the layer is not locked
+func (l *Layer) Editable() bool {
+	return l.Flags&2 == 2 //ASE_LAYER_FLAG_EDITABLE
+}
+
+// LockMovement returns true if the cels of the layer can't be moved
+func (l *Layer) LockMovement() bool {
+	return l.Flags&4 == 4 //ASE_LAYER_FLAG_LOCK_MOVEMENT
+}
+
+// IsBackground returns true for the opaque background layer
+func (l *Layer) IsBackground() bool {
+	return l.Flags&8 == 8 //ASE_LAYER_FLAG_BACKGROUND
+}
+
+// PreferLinkedCels returns true if new cels of the layer are linked by default
+func (l *Layer) PreferLinkedCels() bool {
+	return l.Flags&16 == 16 //ASE_LAYER_FLAG_PREFER_LINKED_CELS
+}
+
+// Collapsed returns true if the group is collapsed in aseprite's timeline
+func (l *Layer) Collapsed() bool {
+	return l.Flags&32 == 32 //ASE_LAYER_FLAG_COLLAPSED
+}
+
+// IsReference returns true for reference layers, which are a guide for the artist and not part of the sprite
+func (l *Layer) IsReference() bool {
+	return l.Flags&64 == 64 //ASE_LAYER_FLAG_REFERENCE
+}
+
+// IsTilemap returns true if the layer is a tilemap using the tileset TilesetIndex
+func (l *Layer) IsTilemap() bool {
+	return l.isTileset
+}
+
+// IsGroup returns true if the layer is a group of other layers
+func (l *Layer) IsGroup() bool {
+	return l.isGroup
+}
+
+// Level returns how deep the layer is nested, 0 for layers at the root of the sprite
+func (l *Layer) Level() int {
+	return int(l.childLevel)
+}
+
+// Parent returns the group containing the layer, or nil for root layers
+func (l *Layer) Parent() *Layer {
+	return l.parent
+}
+
+// Children returns the layers of a group, from bottom to top
+func (l *Layer) Children() []*Layer {
+	return l.children
+}
+
+// EffectiveVisible returns true if the layer and all of its parent groups are visible
+func (l *Layer) EffectiveVisible() bool {
+	for layer := l; layer != nil; layer = layer.parent {
+		if !layer.Visible() {
+			return false
+		}
+	}
+	return true
+}
+
+// EffectiveOpacity returns the opacity of the layer multiplied by the opacity of its parent groups
+func (l *Layer) EffectiveOpacity() uint8 {
+	opacity := 255
+	for layer := l; layer != nil; layer = layer.parent {
+		opacity = opacity * int(layer.opacity) / 255
+	}
+	return uint8(opacity)
+}
+
+// CelAt returns the cel of the layer at frameIndex, or nil if the frame is empty
+func (l *Layer) CelAt(frameIndex int) *Cell {
+	if frameIndex < 0 || frameIndex > 0xFFFF {
+		return nil
+	}
+	return l.cels[uint16(frameIndex)]
+}
+
+// Index returns the position of the layer in the file, which is how cels refer to it
+func (l *Layer) Index() int {
+	return l.index
+}
+
+// Path returns the names of the parent groups and the layer joined by /, e.g. body/arm/shadow
+func (l *Layer) Path() string {
+	if l.parent == nil {
+		return l.Name
+	}
+	return l.parent.Path() + "/" + l.Name
+}
+
+// LayerCount returns the number of layers, including groups
+func (s *Sprite) LayerCount() int {
+	return len(s.coreLayers)
+}
+
+// LayerAt returns the layer at index in file order, or nil if index is out of range
+func (s *Sprite) LayerAt(index int) *Layer {
+	if index < 0 || index >= len(s.coreLayers) {
+		return nil
+	}
+	return s.coreLayers[index]
+}
+
+// OrderedLayers returns every layer, including groups, in file order from bottom to top
+func (s *Sprite) OrderedLayers() []*Layer {
+	layers := make([]*Layer, len(s.coreLayers))
+	copy(layers, s.coreLayers)
+	return layers
+}
+
+// LayersByName returns every layer named name, ignoring case, in file order
+func (s *Sprite) LayersByName(name string) []*Layer {
+	layers := []*Layer{}
+	for _, layer := range s.coreLayers {
+		if strings.EqualFold(layer.Name, name) {
+			layers = append(layers, layer)
+		}
+	}
+	return layers
+}
+
+// LayerByPath returns the layer at path, ignoring case, e.g. body/arm/shadow.
+// If several layers share the same path the first one in file order is returned, nil if none matches
+func (s *Sprite) LayerByPath(path string) *Layer {
+	names := strings.Split(path, "/")
+	layers := s.RootLayers()
+	var match *Layer
+	for _, name := range names {
+		match = nil
+		for _, layer := range layers {
+			if strings.EqualFold(layer.Name, name) {
+				match = layer
+				break
+			}
+		}
+		if match == nil {
+			return nil
+		}
+		layers = match.children
+	}
+	return match
+}
+
+// RootLayers returns the layers not contained by any group, from bottom to top
+func (s *Sprite) RootLayers() []*Layer {
+	layers := []*Layer{}
+	for _, layer := range s.coreLayers {
+		if layer.parent == nil {
+			layers = append(layers, layer)
+		}
+	}
+	return layers
+}
+
+// WalkLayers visits every layer depth first, groups before their children, from bottom to top.
+// Walking stops at the first error returned by fn
+func (s *Sprite) WalkLayers(fn func(layer *Layer) error) error {
+	return walkLayers(s.RootLayers(), fn)
+}
+
+func walkLayers(layers []*Layer, fn func(layer *Layer) error) error {
+	for _, layer := range layers {
+		err := fn(layer)
+		if err != nil {
+			return err
+		}
+		err = walkLayers(layer.children, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,18 +4,25 @@ import (
 	"encoding/binary"
 	"fmt"
 	"image"
+	"image/color"
 	"io"
 )
 
-type mask struct {
-	name   string
-	bounds image.Rectangle
-	img    image.RGBA
+// Mask represents a selection mask, only found in files saved by old versions of aseprite
+type Mask struct {
+	Name string
+	// Image is placed at the mask position inside the sprite, opaque pixels are selected
+	Image *image.Alpha
 }
 
-func readMaskChunk(f io.ReadSeeker) (*mask, error) {
+// Bounds returns the area of the sprite covered by the mask
+func (m *Mask) Bounds() image.Rectangle {
+	return m.Image.Bounds()
+}
+
+func readMaskChunk(f io.ReadSeeker) (*Mask, error) {
 	var err error
-	m := &mask{}
+	m := &Mask{}
 	var x int16
 	err = binary.Read(f, binary.LittleEndian, &x)
 	if err != nil {
@@ -26,12 +33,12 @@ func readMaskChunk(f io.ReadSeeker) (*mask, error) {
 	if err != nil {
 		return nil, fmt.Errorf("y: %w", err)
 	}
-	var w int16
+	var w uint16
 	err = binary.Read(f, binary.LittleEndian, &w)
 	if err != nil {
 		return nil, fmt.Errorf("w: %w", err)
 	}
-	var h int16
+	var h uint16
 	err = binary.Read(f, binary.LittleEndian, &h)
 	if err != nil {
 		return nil, fmt.Errorf("h: %w", err)
@@ -41,24 +48,24 @@ func readMaskChunk(f io.ReadSeeker) (*mask, error) {
 	if err != nil {
 		return nil, fmt.Errorf("seek name: %w", err)
 	}
-	m.name, err = readString(f)
+	m.Name, err = readString(f)
 	if err != nil {
 		return nil, fmt.Errorf("name: %w", err)
 	}
-	m.bounds = image.Rect(int(x), int(y), int(w), int(h))
-	for v := int16(0); v < h; v++ {
-		for u := int16(0); u < (w+7)/8; u++ {
-			var bData int8
-			err = binary.Read(f, binary.LittleEndian, &bData)
-			if err != nil {
-				return nil, fmt.Errorf("bData: %w", err)
-			}
-			for c := 0; c < 8; c++ {
-				fmt.Println(bData & (1 << (7 - c)))
-				//m.img.SetRGBA(u*8+c, v,byte & (1<<(7-c)))
+	m.Image = image.NewAlpha(image.Rect(int(x), int(y), int(x)+int(w), int(y)+int(h)))
+	//each row is packed 8 pixels per byte, most significant bit first
+	rowSize := (int(w) + 7) / 8
+	row := make([]byte, rowSize)
+	for v := 0; v < int(h); v++ {
+		_, err = io.ReadFull(f, row)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", v, err)
+		}
+		for u := 0; u < int(w); u++ {
+			if row[u/8]&(1<<(7-uint(u%8))) != 0 {
+				m.Image.SetAlpha(int(x)+u, int(y)+v, color.Alpha{A: 255})
 			}
 		}
 	}
 	return m, nil
-
 }
@@ -7,11 +7,65 @@ import (
 	"io"
 )
 
-type palette struct {
-	colors []color.RGBA
+// Palette represents the color palette of a sprite
+type Palette struct {
+	// Colors are stored non-premultiplied, as saved by aseprite
+	Colors []color.NRGBA
+	// Names holds the name of each entry, empty if the entry has no name
+	Names []string
 }
 
-func readPaletteChunk(f io.ReadSeeker, frameIndex uint16, flags uint32) (*palette, error) {
+// Len returns the number of entries in the palette
+func (p *Palette) Len() int {
+	return len(p.Colors)
+}
+
+// Name returns the name of entry index, or an empty string if it has none
+func (p *Palette) Name(index int) string {
+	if index < 0 || index >= len(p.Names) {
+		return ""
+	}
+	return p.Names[index]
+}
+
+// size returns the number of entries, 0 for a nil palette
+func (p *Palette) size() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.Colors)
+}
+
+// colorPalette returns the entries as a color.Palette, nil for a nil palette
+func (p *Palette) colorPalette() color.Palette {
+	if p == nil {
+		return nil
+	}
+	cp := make(color.Palette, len(p.Colors))
+	for i, c := range p.Colors {
+		cp[i] = c
+	}
+	return cp
+}
+
+// clone returns a copy of the palette resized to size entries, new entries are opaque black
+func (p *Palette) clone(size int) *Palette {
+	np := &Palette{
+		Colors: make([]color.NRGBA, size),
+		Names:  make([]string, size),
+	}
+	for i := range np.Colors {
+		np.Colors[i] = color.NRGBA{A: 255}
+	}
+	if p != nil {
+		copy(np.Colors, p.Colors)
+		copy(np.Names, p.Names)
+	}
+	return np
+}
+
+// readPaletteChunk applies a palette chunk on top of pal, which may be nil, and returns the result as a new palette
+func readPaletteChunk(f io.ReadSeeker, pal *Palette) (*Palette, error) {
 	var err error
 	var newSize int32
 	err = binary.Read(f, binary.LittleEndian, &newSize)
@@ -34,7 +88,10 @@ func readPaletteChunk(f io.ReadSeeker, frameIndex uint16, flags uint32) (*palett
 	if err != nil {
 		return nil, fmt.Errorf("seek pallette: %w", err)
 	}
-	p := new(palette)
+	if newSize < 0 || from < 0 || to >= newSize {
+		return nil, fmt.Errorf("invalid palette range %d-%d for size %d", from, to, newSize)
+	}
+	p := pal.clone(int(newSize))
 	for i := from; i <= to; i++ {
 		var flags int16
 		err = binary.Read(f, binary.LittleEndian, &flags)
@@ -61,10 +118,10 @@ func readPaletteChunk(f io.ReadSeeker, frameIndex uint16, flags uint32) (*palett
 		if err != nil {
 			return nil, fmt.Errorf("a %d: %w", i, err)
 		}
-		p.colors = append(p.colors, color.RGBA{R: r, G: g, B: b, A: a})
+		p.Colors[i] = color.NRGBA{R: r, G: g, B: b, A: a}
+		p.Names[i] = ""
 		if flags&1 == 1 { //ASE_PALETTE_FLAG_HAS_NAME
-			var name string
-			err = binary.Read(f, binary.LittleEndian, &name)
+			p.Names[i], err = readString(f)
 			if err != nil {
 				return nil, fmt.Errorf("name %d: %w", i, err)
 			}
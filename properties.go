@@ -0,0 +1,271 @@
+package aseprite
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+)
+
+// Properties holds the properties maps of user data keyed by extension, key 0 holds the user's own properties
+// and any other key is the id of the extension entry in the external files chunk
+type Properties map[uint32]PropertyMap
+
+// PropertyMap holds named property values. Values are bool, int8, uint8, int16, uint16, int32, uint32,
+// int64, uint64, Fixed, float32, float64, string, image.Point, Size, image.Rectangle, UUID,
+// []interface{} for vectors or PropertyMap for nested maps
+type PropertyMap map[string]interface{}
+
+// Size is the value of a size property
+type Size struct {
+	Width  int
+	Height int
+}
+
+// Bool returns the named bool property
+func (m PropertyMap) Bool(name string) (bool, bool) {
+	value, ok := m[name].(bool)
+	return value, ok
+}
+
+// Int returns the named property of any integer type
+func (m PropertyMap) Int(name string) (int64, bool) {
+	switch value := m[name].(type) {
+	case int8:
+		return int64(value), true
+	case uint8:
+		return int64(value), true
+	case int16:
+		return int64(value), true
+	case uint16:
+		return int64(value), true
+	case int32:
+		return int64(value), true
+	case uint32:
+		return int64(value), true
+	case int64:
+		return value, true
+	case uint64:
+		return int64(value), true
+	}
+	return 0, false
+}
+
+// Float returns the named fixed, float or double property
+func (m PropertyMap) Float(name string) (float64, bool) {
+	switch value := m[name].(type) {
+	case Fixed:
+		return value.Float64(), true
+	case float32:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
+
+// String returns the named string property
+func (m PropertyMap) String(name string) (string, bool) {
+	value, ok := m[name].(string)
+	return value, ok
+}
+
+// Point returns the named point property
+func (m PropertyMap) Point(name string) (image.Point, bool) {
+	value, ok := m[name].(image.Point)
+	return value, ok
+}
+
+// Size returns the named size property
+func (m PropertyMap) Size(name string) (Size, bool) {
+	value, ok := m[name].(Size)
+	return value, ok
+}
+
+// Rect returns the named rect property
+func (m PropertyMap) Rect(name string) (image.Rectangle, bool) {
+	value, ok := m[name].(image.Rectangle)
+	return value, ok
+}
+
+// UUID returns the named uuid property
+func (m PropertyMap) UUID(name string) (UUID, bool) {
+	value, ok := m[name].(UUID)
+	return value, ok
+}
+
+// Vector returns the named vector property
+func (m PropertyMap) Vector(name string) ([]interface{}, bool) {
+	value, ok := m[name].([]interface{})
+	return value, ok
+}
+
+// Map returns the named nested properties map
+func (m PropertyMap) Map(name string) (PropertyMap, bool) {
+	value, ok := m[name].(PropertyMap)
+	return value, ok
+}
+
+func readProperties(f io.ReadSeeker) (Properties, error) {
+	var err error
+	start, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("start: %w", err)
+	}
+	var size uint32
+	err = binary.Read(f, binary.LittleEndian, &size)
+	if err != nil {
+		return nil, fmt.Errorf("size: %w", err)
+	}
+	var mapCount uint32
+	err = binary.Read(f, binary.LittleEndian, &mapCount)
+	if err != nil {
+		return nil, fmt.Errorf("mapCount: %w", err)
+	}
+	props := Properties{}
+	for i := uint32(0); i < mapCount; i++ {
+		var key uint32
+		err = binary.Read(f, binary.LittleEndian, &key)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		m, err := readPropertyMap(f)
+		if err != nil {
+			return nil, fmt.Errorf("map %d: %w", key, err)
+		}
+		props[key] = m
+	}
+	//size covers every map, so the next field is found even if a map wasn't fully read
+	_, err = f.Seek(start+int64(size), io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("seek properties end: %w", err)
+	}
+	return props, nil
+}
+
+func readPropertyMap(f io.ReadSeeker) (PropertyMap, error) {
+	var err error
+	var count uint32
+	err = binary.Read(f, binary.LittleEndian, &count)
+	if err != nil {
+		return nil, fmt.Errorf("count: %w", err)
+	}
+	m := PropertyMap{}
+	for i := uint32(0); i < count; i++ {
+		name, err := readString(f)
+		if err != nil {
+			return nil, fmt.Errorf("name %d: %w", i, err)
+		}
+		var propertyType uint16
+		err = binary.Read(f, binary.LittleEndian, &propertyType)
+		if err != nil {
+			return nil, fmt.Errorf("type %s: %w", name, err)
+		}
+		m[name], err = readPropertyValue(f, propertyType)
+		if err != nil {
+			return nil, fmt.Errorf("value %s: %w", name, err)
+		}
+	}
+	return m, nil
+}
+
+func readPropertyValue(f io.ReadSeeker, propertyType uint16) (interface{}, error) {
+	var err error
+	switch propertyType {
+	case 0x0001: //bool
+		var value uint8
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return value != 0, err
+	case 0x0002: //int8
+		var value int8
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return value, err
+	case 0x0003: //uint8
+		var value uint8
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return value, err
+	case 0x0004: //int16
+		var value int16
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return value, err
+	case 0x0005: //uint16
+		var value uint16
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return value, err
+	case 0x0006: //int32
+		var value int32
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return value, err
+	case 0x0007: //uint32
+		var value uint32
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return value, err
+	case 0x0008: //int64
+		var value int64
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return value, err
+	case 0x0009: //uint64
+		var value uint64
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return value, err
+	case 0x000A: //fixed
+		var value Fixed
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return value, err
+	case 0x000B: //float
+		var value float32
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return value, err
+	case 0x000C: //double
+		var value float64
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return value, err
+	case 0x000D: //string
+		return readString(f)
+	case 0x000E: //point
+		var value [2]int32
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return image.Pt(int(value[0]), int(value[1])), err
+	case 0x000F: //size
+		var value [2]int32
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return Size{Width: int(value[0]), Height: int(value[1])}, err
+	case 0x0010: //rect
+		var value [4]int32
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return image.Rect(int(value[0]), int(value[1]), int(value[0]+value[2]), int(value[1]+value[3])), err
+	case 0x0011: //vector
+		var count uint32
+		err = binary.Read(f, binary.LittleEndian, &count)
+		if err != nil {
+			return nil, fmt.Errorf("count: %w", err)
+		}
+		var elementType uint16
+		err = binary.Read(f, binary.LittleEndian, &elementType)
+		if err != nil {
+			return nil, fmt.Errorf("elementType: %w", err)
+		}
+		values := make([]interface{}, count)
+		for i := range values {
+			valueType := elementType
+			if elementType == 0 { //mixed vectors store the type of each element
+				err = binary.Read(f, binary.LittleEndian, &valueType)
+				if err != nil {
+					return nil, fmt.Errorf("type %d: %w", i, err)
+				}
+			}
+			values[i], err = readPropertyValue(f, valueType)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		return values, nil
+	case 0x0012: //nested properties map
+		return readPropertyMap(f)
+	case 0x0013: //uuid
+		var value UUID
+		err = binary.Read(f, binary.LittleEndian, &value)
+		return value, err
+	}
+	return nil, fmt.Errorf("unknown property type %d", propertyType)
+}
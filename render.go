@@ -0,0 +1,392 @@
+package aseprite
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"path"
+	"sort"
+	"strings"
+)
+
+// RenderOptions controls which layers are composited and how the result is scaled
+type RenderOptions struct {
+	Include         []string // layer names or paths as path.Match patterns, only matching layers and their children are rendered when set
+	Exclude         []string // layer names or paths as path.Match patterns, matching layers and their children are not rendered
+	ShowHidden      bool     // renders hidden layers as if they were visible
+	NoBackground    bool     // skips the background layer
+	Solo            string   // path of a group, only its layers are rendered when set
+	ReferenceLayers bool     // renders reference layers, aseprite skips them when exporting
+	Scale           int      // integer upscaling factor with nearest neighbor sampling, 0 and 1 keep the sprite size
+	PixelRatio      bool     // stretches pixels to the pixel ratio of the sprite, e.g. 2:1 pixels render twice as wide
+	ConvertToSRGB   bool     // converts the rendered colors from the color profile of the sprite to sRGB, see ColorProfile.ConvertToSRGB
+	NearestIndex    bool     // RenderFrameIndexed maps blended colors missing from the palette to the nearest entry instead of failing
+}
+
+// RenderFrame composites the visible layers of frameIndex into an image of the sprite size.
+// Layer and cel opacity, blend modes and group visibility are applied like aseprite does, reference layers are skipped.
+// It returns nil if frameIndex is out of range
+func (s *Sprite) RenderFrame(frameIndex int) *image.NRGBA {
+	img, err := s.RenderFrameWithOptions(frameIndex, RenderOptions{})
+	if err != nil {
+		return nil
+	}
+	return img
+}
+
+// RenderFrameWithOptions composites the layers of frameIndex selected by opts into an image of the sprite size,
+// multiplied by opts.Scale and the pixel ratio when opts.PixelRatio is set
+func (s *Sprite) RenderFrameWithOptions(frameIndex int, opts RenderOptions) (*image.NRGBA, error) {
+	r, err := s.newRenderer(frameIndex, opts)
+	if err != nil {
+		return nil, err
+	}
+	canvas := r.render()
+	if opts.ConvertToSRGB && s.ColorProfile != nil {
+		err = s.ColorProfile.ConvertToSRGB(canvas)
+		if err != nil {
+			return nil, fmt.Errorf("color profile: %w", err)
+		}
+	}
+	scaleX, scaleY := r.scale()
+	return scaleImage(canvas, scaleX, scaleY), nil
+}
+
+// RenderFrameIndexed composites frameIndex like RenderFrameWithOptions into an image using the palette of the frame,
+// keeping the palette indices of the cels. The transparent index is made transparent in the palette unless a background layer is rendered.
+// Pixels drawn with a partial opacity, a blend mode other than normal, or a translucent palette entry over other pixels
+// get a blended color and have no index to keep: they are mapped to the nearest palette entry when opts.NearestIndex is set,
+// otherwise an error is returned
+func (s *Sprite) RenderFrameIndexed(frameIndex int, opts RenderOptions) (*image.Paletted, error) {
+	if s.ColorMode() != ColorModeIndexed {
+		return nil, fmt.Errorf("color mode %s is not indexed", s.ColorMode())
+	}
+	r, err := s.newRenderer(frameIndex, opts)
+	if err != nil {
+		return nil, err
+	}
+	pal := s.PaletteAt(frameIndex).colorPalette()
+	if len(pal) == 0 {
+		return nil, fmt.Errorf("frame %d has no palette", frameIndex)
+	}
+	r.palette = s.PaletteAt(frameIndex)
+	r.indexes = image.NewPaletted(image.Rect(0, 0, int(s.Width), int(s.Height)), pal)
+	for i := range r.indexes.Pix {
+		r.indexes.Pix[i] = s.transparentIndex
+	}
+	r.painted = make([]bool, len(r.indexes.Pix))
+	r.blended = make([]bool, len(r.indexes.Pix))
+	canvas := r.render()
+	if int(s.transparentIndex) < len(pal) && !r.drewBackground {
+		pal[s.transparentIndex] = color.NRGBA{}
+	}
+
+	for y := 0; y < int(s.Height); y++ {
+		for x := 0; x < int(s.Width); x++ {
+			i := r.indexes.PixOffset(x, y)
+			if !r.blended[i] {
+				continue
+			}
+			c := canvas.NRGBAAt(x, y)
+			if c.A == 0 {
+				r.indexes.Pix[i] = s.transparentIndex
+				continue
+			}
+			if !opts.NearestIndex {
+				return nil, fmt.Errorf("pixel %d,%d: blended color %v has no palette index", x, y, c)
+			}
+			r.indexes.Pix[i] = uint8(pal.Index(c))
+		}
+	}
+	if opts.ConvertToSRGB && s.ColorProfile != nil { //converting the palette keeps the indices
+		err = s.ColorProfile.convertPalette(pal)
+		if err != nil {
+			return nil, fmt.Errorf("color profile: %w", err)
+		}
+	}
+	scaleX, scaleY := r.scale()
+	return scalePaletted(r.indexes, scaleX, scaleY), nil
+}
+
+// renderer holds the state of a render call
+type renderer struct {
+	sprite     *Sprite
+	opts       RenderOptions
+	frameIndex int
+	solo       *Layer
+	// indexes receives the palette indices of the rendered cels when set
+	indexes *image.Paletted
+	palette *Palette
+	// painted and blended tell for each pixel of indexes if a cel covers it, and if its color was blended
+	painted []bool
+	blended []bool
+	// translucentGroups and blendModeGroups count the composited groups being rendered with a partial opacity or a blend mode
+	translucentGroups int
+	blendModeGroups   int
+	drewBackground    bool
+}
+
+// newRenderer validates opts and returns a renderer for frameIndex
+func (s *Sprite) newRenderer(frameIndex int, opts RenderOptions) (*renderer, error) {
+	if frameIndex < 0 || frameIndex >= len(s.Frames) {
+		return nil, fmt.Errorf("frame %d out of range (%d)", frameIndex, len(s.Frames))
+	}
+	if opts.Scale < 0 {
+		return nil, fmt.Errorf("invalid scale %d", opts.Scale)
+	}
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", pattern, err)
+		}
+	}
+	r := &renderer{
+		sprite:     s,
+		opts:       opts,
+		frameIndex: frameIndex,
+	}
+	if opts.Solo != "" {
+		r.solo = s.LayerByPath(opts.Solo)
+		if r.solo == nil {
+			return nil, fmt.Errorf("solo layer %s not found", opts.Solo)
+		}
+	}
+	return r, nil
+}
+
+// render composites the frame into an image of the sprite size
+func (r *renderer) render() *image.NRGBA {
+	canvas := image.NewNRGBA(image.Rect(0, 0, int(r.sprite.Width), int(r.sprite.Height)))
+	if r.sprite.HasGroupComposition() {
+		r.renderGroup(canvas, r.sprite.RootLayers())
+		return canvas
+	}
+	//groups only organize layers, cels are composited as a flat list
+	for _, c := range r.sprite.Frames[r.frameIndex].OrderedCels() {
+		if !r.isSelected(c.layer) {
+			continue
+		}
+		shown := true
+		for l := c.layer; l != nil; l = l.parent {
+			shown = shown && r.isShown(l)
+		}
+		if shown {
+			r.renderCel(canvas, c)
+		}
+	}
+	return canvas
+}
+
+// scale returns the horizontal and vertical upscaling factors of the render
+func (r *renderer) scale() (int, int) {
+	scaleX, scaleY := 1, 1
+	if r.opts.Scale > 1 {
+		scaleX, scaleY = r.opts.Scale, r.opts.Scale
+	}
+	if r.opts.PixelRatio && r.sprite.pixelRatio.Width > 0 && r.sprite.pixelRatio.Height > 0 {
+		scaleX *= r.sprite.pixelRatio.Width
+		scaleY *= r.sprite.pixelRatio.Height
+	}
+	return scaleX, scaleY
+}
+
+// renderGroup composites sibling layers onto canvas from bottom to top, groups being composited on their own
+func (r *renderer) renderGroup(canvas *image.NRGBA, layers []*Layer) {
+	for _, layer := range orderLayers(layers, r.frameIndex) {
+		if !r.isShown(layer) {
+			continue
+		}
+		if layer.isGroup {
+			isTranslucent := layer.opacity != 255
+			isBlendMode := layer.BlendMode != blendModeNormal
+			if isTranslucent {
+				r.translucentGroups++
+			}
+			if isBlendMode {
+				r.blendModeGroups++
+			}
+			group := image.NewNRGBA(canvas.Bounds())
+			r.renderGroup(group, layer.children)
+			if isTranslucent {
+				r.translucentGroups--
+			}
+			if isBlendMode {
+				r.blendModeGroups--
+			}
+			blendImage(canvas, group, image.Point{}, int(layer.opacity), layer.BlendMode)
+			continue
+		}
+		c := layer.CelAt(r.frameIndex)
+		if c != nil && r.isSelected(layer) {
+			r.renderCel(canvas, c)
+		}
+	}
+}
+
+// isShown returns true if layer itself passes the visibility, reference, background and exclude options
+func (r *renderer) isShown(layer *Layer) bool {
+	if !layer.Visible() && !r.opts.ShowHidden {
+		return false
+	}
+	if layer.IsReference() && !r.opts.ReferenceLayers {
+		return false
+	}
+	if layer.IsBackground() && r.opts.NoBackground {
+		return false
+	}
+	return !matchLayer(layer, r.opts.Exclude)
+}
+
+// isSelected returns true if layer or one of its groups is selected by opts.Include and opts.Solo
+func (r *renderer) isSelected(layer *Layer) bool {
+	included := len(r.opts.Include) == 0
+	soloed := r.solo == nil
+	for l := layer; l != nil; l = l.parent {
+		included = included || matchLayer(l, r.opts.Include)
+		soloed = soloed || l == r.solo
+	}
+	return included && soloed
+}
+
+// renderCel blends c onto canvas with the opacity and blend mode of its layer
+func (r *renderer) renderCel(canvas *image.NRGBA, c *Cell) {
+	if c.Image == nil {
+		return
+	}
+	opacity := mulUn8(int(uint8(c.Opacity)), int(c.layer.opacity))
+	position := image.Pt(int(c.PositionX), int(c.PositionY))
+	blendImage(canvas, c.Image, position, opacity, c.layer.BlendMode)
+	if r.indexes != nil && c.indexes != nil && opacity > 0 {
+		isFullOpacity := opacity == 255 && r.translucentGroups == 0
+		isNormal := c.layer.BlendMode == blendModeNormal && r.blendModeGroups == 0
+		r.paintIndexes(c.indexes, position, c.layer.IsBackground(), isFullOpacity, isNormal)
+	}
+}
+
+// paintIndexes copies the indices of src placed at position, skipping the transparent index unless opaque is set.
+// Pixels drawn without isFullOpacity are marked as blended. Over painted pixels, so are the ones drawn without isNormal
+// or with a translucent palette entry, as blend modes only place the source like normal blending over empty pixels
+func (r *renderer) paintIndexes(src *image.Paletted, position image.Point, opaque bool, isFullOpacity bool, isNormal bool) {
+	if opaque {
+		r.drewBackground = true
+	}
+	area := src.Bounds().Add(position).Intersect(r.indexes.Bounds())
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			index := src.ColorIndexAt(x-position.X, y-position.Y)
+			if index == r.sprite.transparentIndex && !opaque {
+				continue
+			}
+			alpha := uint8(0)
+			if int(index) < r.palette.size() {
+				alpha = r.palette.Colors[index].A
+			}
+			if alpha == 0 { //leaves the pixel below untouched
+				continue
+			}
+			i := r.indexes.PixOffset(x, y)
+			r.blended[i] = !isFullOpacity || (r.painted[i] && (!isNormal || alpha != 255))
+			r.painted[i] = true
+			r.indexes.Pix[i] = index
+		}
+	}
+}
+
+// matchLayer returns true if the name or path of layer matches any of patterns, ignoring case
+func matchLayer(layer *Layer, patterns []string) bool {
+	name := strings.ToLower(layer.Name)
+	layerPath := strings.ToLower(layer.Path())
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, layerPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// scaleImage enlarges src by integer factors, repeating each pixel
+func scaleImage(src *image.NRGBA, scaleX int, scaleY int) *image.NRGBA {
+	if scaleX == 1 && scaleY == 1 {
+		return src
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, src.Rect.Dx()*scaleX, src.Rect.Dy()*scaleY))
+	scalePix(dst.Pix, dst.Stride, src.Pix[src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y):], src.Stride, dst.Rect.Dx(), dst.Rect.Dy(), 4, scaleX, scaleY)
+	return dst
+}
+
+// scalePaletted enlarges src by integer factors, repeating each pixel
+func scalePaletted(src *image.Paletted, scaleX int, scaleY int) *image.Paletted {
+	if scaleX == 1 && scaleY == 1 {
+		return src
+	}
+	dst := image.NewPaletted(image.Rect(0, 0, src.Rect.Dx()*scaleX, src.Rect.Dy()*scaleY), src.Palette)
+	scalePix(dst.Pix, dst.Stride, src.Pix[src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y):], src.Stride, dst.Rect.Dx(), dst.Rect.Dy(), 1, scaleX, scaleY)
+	return dst
+}
+
+// scalePix fills width by height pixels of bpp bytes in dst, sampling src with nearest neighbor
+func scalePix(dst []byte, dstStride int, src []byte, srcStride int, width int, height int, bpp int, scaleX int, scaleY int) {
+	for y := 0; y < height; y++ {
+		srcRow := src[(y/scaleY)*srcStride:]
+		dstRow := dst[y*dstStride:]
+		for x := 0; x < width; x++ {
+			copy(dstRow[x*bpp:(x+1)*bpp], srcRow[(x/scaleX)*bpp:(x/scaleX+1)*bpp])
+		}
+	}
+}
+
+// orderLayers sorts sibling layers in compositing order, moving layers by the z-index of their cel at frameIndex.
+// Like Frame.OrderedCels, but with the positions of the layers among their siblings
+func orderLayers(layers []*Layer, frameIndex int) []*Layer {
+	type orderedLayer struct {
+		layer  *Layer
+		order  int
+		zIndex int
+	}
+	ordered := make([]orderedLayer, len(layers))
+	for i, layer := range layers {
+		ordered[i] = orderedLayer{layer: layer, order: i}
+		if c := layer.CelAt(frameIndex); c != nil {
+			ordered[i].zIndex = int(c.ZIndex)
+			ordered[i].order += int(c.ZIndex)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].order != ordered[j].order {
+			return ordered[i].order < ordered[j].order
+		}
+		return ordered[i].zIndex < ordered[j].zIndex
+	})
+	sorted := make([]*Layer, len(ordered))
+	for i, ol := range ordered {
+		sorted[i] = ol.layer
+	}
+	return sorted
+}
+
+// blendImage blends src placed at position onto canvas, clipping whatever falls outside
+func blendImage(canvas *image.NRGBA, src *image.NRGBA, position image.Point, opacity int, blendMode int16) {
+	if opacity <= 0 {
+		return
+	}
+	blend := blendFunc(blendMode)
+	srcBounds := src.Bounds()
+	area := srcBounds.Add(position.Sub(srcBounds.Min)).Intersect(canvas.Bounds())
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			sc := src.NRGBAAt(x-position.X+srcBounds.Min.X, y-position.Y+srcBounds.Min.Y)
+			if sc.A == 0 && blendMode >= blendModeNormal {
+				continue
+			}
+			i := canvas.PixOffset(x, y)
+			pix := canvas.Pix[i : i+4 : i+4]
+			bc := color.NRGBA{R: pix[0], G: pix[1], B: pix[2], A: pix[3]}
+			rc := blend(bc, sc, opacity)
+			pix[0], pix[1], pix[2], pix[3] = rc.R, rc.G, rc.B, rc.A
+		}
+	}
+}
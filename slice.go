@@ -5,22 +5,45 @@ import (
 	"fmt"
 	"image"
 	"io"
+	"sort"
 )
 
-// Slice represents a slice
+// Slice represents a named area of the sprite, such as a hitbox or a 9-patch
 type Slice struct {
-	name       string
-	bounds     image.Rectangle
-	center     image.Rectangle
-	pivot      image.Point
-	frameIndex uint16
-	UserData   *UserData
+	Name string
+	// Keys are sorted by frame, each key is in effect from its frame until the next key
+	Keys     []*SliceKey
+	UserData *UserData
 }
 
-type sliceKey struct {
+// SliceKey represents the state of a slice starting at Frame
+type SliceKey struct {
+	Frame  int
+	Bounds image.Rectangle
+	// Center is the 9-patch center relative to Bounds, nil if the slice isn't a 9-patch
+	Center *image.Rectangle
+	// Pivot is relative to the origin of Bounds, nil if the slice has no pivot
+	Pivot *image.Point
 }
 
-func readSlicesChunk(f io.ReadSeeker, frameIndex uint16, s *Sprite) error {
+// At returns the key in effect at frameIndex, or nil if the slice doesn't exist yet on that frame
+func (sl *Slice) At(frameIndex int) *SliceKey {
+	var key *SliceKey
+	for _, k := range sl.Keys {
+		if k.Frame > frameIndex {
+			break
+		}
+		key = k
+	}
+	return key
+}
+
+// Slices returns the slices of the sprite
+func (s *Sprite) Slices() []*Slice {
+	return s.slices
+}
+
+func readSlicesChunk(f io.ReadSeeker, s *Sprite) error {
 	var err error
 	var sliceCount int32
 	err = binary.Read(f, binary.LittleEndian, &sliceCount)
@@ -33,7 +56,7 @@ func readSlicesChunk(f io.ReadSeeker, frameIndex uint16, s *Sprite) error {
 	}
 
 	for i := int32(0); i < sliceCount; i++ {
-		_, err = readSliceChunk(f, frameIndex, s)
+		_, err = readSliceChunk(f, s)
 		if err != nil {
 			return fmt.Errorf("readSliceChunk %d: %w", i, err)
 		}
@@ -41,9 +64,11 @@ func readSlicesChunk(f io.ReadSeeker, frameIndex uint16, s *Sprite) error {
 	return nil
 }
 
-func readSliceChunk(f io.ReadSeeker, frameIndex uint16, s *Sprite) (*Slice, error) {
+func readSliceChunk(f io.ReadSeeker, s *Sprite) (*Slice, error) {
 	var err error
-	sl := new(Slice)
+	sl := &Slice{
+		UserData: &UserData{},
+	}
 	var keyCount int32
 	err = binary.Read(f, binary.LittleEndian, &keyCount)
 	if err != nil {
@@ -59,55 +84,29 @@ func readSliceChunk(f io.ReadSeeker, frameIndex uint16, s *Sprite) (*Slice, erro
 		return nil, fmt.Errorf("seek name: %w", err)
 	}
 
-	sl.name, err = readString(f)
+	sl.Name, err = readString(f)
 	if err != nil {
 		return nil, fmt.Errorf("name: %w", err)
 	}
 
 	for j := int32(0); j < keyCount; j++ {
-		var x int32
-		err = binary.Read(f, binary.LittleEndian, &x)
-		if err != nil {
-			return nil, fmt.Errorf("x: %w", err)
-		}
-		var y int32
-		err = binary.Read(f, binary.LittleEndian, &y)
+		key := new(SliceKey)
+		var frame uint32
+		err = binary.Read(f, binary.LittleEndian, &frame)
 		if err != nil {
-			return nil, fmt.Errorf("y: %w", err)
+			return nil, fmt.Errorf("frame: %w", err)
 		}
-		var w int32
-		err = binary.Read(f, binary.LittleEndian, &w)
+		key.Frame = int(frame)
+		key.Bounds, err = readSliceRect(f)
 		if err != nil {
-			return nil, fmt.Errorf("w: %w", err)
+			return nil, fmt.Errorf("bounds %d: %w", j, err)
 		}
-		var h int32
-		err = binary.Read(f, binary.LittleEndian, &h)
-		if err != nil {
-			return nil, fmt.Errorf("h: %w", err)
-		}
-		sl.bounds = image.Rect(int(x), int(y), int(w), int(h))
 		if flags&1 == 1 { //ASE_SLICE_FLAG_HAS_CENTER_BOUNDS
-			var x int32
-			err = binary.Read(f, binary.LittleEndian, &x)
-			if err != nil {
-				return nil, fmt.Errorf("x: %w", err)
-			}
-			var y int32
-			err = binary.Read(f, binary.LittleEndian, &y)
+			center, err := readSliceRect(f)
 			if err != nil {
-				return nil, fmt.Errorf("y: %w", err)
+				return nil, fmt.Errorf("center %d: %w", j, err)
 			}
-			var w int32
-			err = binary.Read(f, binary.LittleEndian, &w)
-			if err != nil {
-				return nil, fmt.Errorf("w: %w", err)
-			}
-			var h int32
-			err = binary.Read(f, binary.LittleEndian, &h)
-			if err != nil {
-				return nil, fmt.Errorf("h: %w", err)
-			}
-			sl.center = image.Rect(int(x), int(y), int(w), int(h))
+			key.Center = &center
 		}
 		if flags&2 == 2 { //ASE_SLICE_FLAG_HAS_PIVOT_POINT
 			var x int32
@@ -120,10 +119,40 @@ func readSliceChunk(f io.ReadSeeker, frameIndex uint16, s *Sprite) (*Slice, erro
 			if err != nil {
 				return nil, fmt.Errorf("y: %w", err)
 			}
-			sl.pivot = image.Pt(int(x), int(y))
+			pivot := image.Pt(int(x), int(y))
+			key.Pivot = &pivot
 		}
-		sl.frameIndex = frameIndex
-		s.slices = append(s.slices, sl)
+		sl.Keys = append(sl.Keys, key)
 	}
+	sort.SliceStable(sl.Keys, func(i, j int) bool {
+		return sl.Keys[i].Frame < sl.Keys[j].Frame
+	})
+	s.slices = append(s.slices, sl)
 	return sl, nil
 }
+
+// readSliceRect reads a rectangle stored as origin and size
+func readSliceRect(f io.ReadSeeker) (image.Rectangle, error) {
+	var err error
+	var x int32
+	err = binary.Read(f, binary.LittleEndian, &x)
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("x: %w", err)
+	}
+	var y int32
+	err = binary.Read(f, binary.LittleEndian, &y)
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("y: %w", err)
+	}
+	var w uint32
+	err = binary.Read(f, binary.LittleEndian, &w)
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("w: %w", err)
+	}
+	var h uint32
+	err = binary.Read(f, binary.LittleEndian, &h)
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("h: %w", err)
+	}
+	return image.Rect(int(x), int(y), int(x)+int(w), int(y)+int(h)), nil
+}
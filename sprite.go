@@ -1,6 +1,10 @@
 package aseprite
 
-import "image"
+import (
+	"fmt"
+	"image"
+	"time"
+)
 
 const (
 	pixelFormatNone = iota
@@ -19,11 +23,126 @@ type Sprite struct {
 	ncolors          uint16
 	speed            uint16
 	transparentIndex uint8
-	colorSpace       int
-	pixelRatio       float32
+	flags            uint32
+	pixelRatio       PixelRatio
 	gridBounds       image.Rectangle
+	Palette          *Palette
+	palettes         []*Palette
+	Frames           []*Frame
 	Tags             []*Tag
+	Tilesets         []*Tileset
+	Masks            []*Mask
+	ExternalFiles    []*ExternalFile
+	ColorProfile     *ColorProfile
+	UserData         *UserData
 	slices           []*Slice
 	coreLayers       []*Layer
-	Layers           map[string]*Layer
+	// Layers is keyed by lower case layer name, layers sharing a name overwrite each other.
+	//
+	// Deprecated: use LayerAt, LayerByPath or LayersByName instead
+	Layers map[string]*Layer
+}
+
+// ColorMode is the pixel format of a sprite
+type ColorMode int
+
+const (
+	// ColorModeRGBA stores 32 bit RGBA pixels
+	ColorModeRGBA ColorMode = 32
+	// ColorModeGrayscale stores 16 bit gray and alpha pixels
+	ColorModeGrayscale ColorMode = 16
+	// ColorModeIndexed stores 8 bit palette indexes
+	ColorModeIndexed ColorMode = 8
+)
+
+// String returns the name of the color mode
+func (cm ColorMode) String() string {
+	switch cm {
+	case ColorModeRGBA:
+		return "rgba"
+	case ColorModeGrayscale:
+		return "grayscale"
+	case ColorModeIndexed:
+		return "indexed"
+	}
+	return fmt.Sprintf("colormode(%d)", int(cm))
+}
+
+// PixelRatio is the width to height ratio of a single pixel, 1:1 for square pixels
+type PixelRatio struct {
+	Width  int
+	Height int
+}
+
+// Float64 returns the ratio as width divided by height
+func (pr PixelRatio) Float64() float64 {
+	return float64(pr.Width) / float64(pr.Height)
+}
+
+// IsSquare returns true if pixels are as wide as they are tall
+func (pr PixelRatio) IsSquare() bool {
+	return pr.Width == pr.Height
+}
+
+// ColorMode returns the pixel format of the sprite, which is also its color depth in bits
+func (s *Sprite) ColorMode() ColorMode {
+	return ColorMode(s.depth)
+}
+
+// PixelRatio returns the pixel aspect ratio of the sprite
+func (s *Sprite) PixelRatio() PixelRatio {
+	return s.pixelRatio
+}
+
+// Grid returns the first cell of the sprite grid, the grid repeats from there
+func (s *Sprite) Grid() image.Rectangle {
+	return s.gridBounds
+}
+
+// TransparentIndex returns the palette entry used as transparent color, only used by indexed sprites
+func (s *Sprite) TransparentIndex() int {
+	return int(s.transparentIndex)
+}
+
+// NumColors returns the number of colors declared in the header, 256 for files saved before the field existed
+func (s *Sprite) NumColors() int {
+	return int(s.ncolors)
+}
+
+// FrameCount returns the number of frames
+func (s *Sprite) FrameCount() int {
+	return int(s.frameCount)
+}
+
+// Speed returns the deprecated header frame duration, used for frames without a duration
+func (s *Sprite) Speed() time.Duration {
+	return time.Duration(s.speed) * time.Millisecond
+}
+
+// Flags returns the raw header flags
+func (s *Sprite) Flags() uint32 {
+	return s.flags
+}
+
+// HasLayerOpacity returns true if layer opacity is stored in the file
+func (s *Sprite) HasLayerOpacity() bool {
+	return s.flags&1 == 1 //ASE_FILE_FLAG_LAYER_WITH_OPACITY
+}
+
+// HasGroupComposition returns true if group blend mode and opacity are stored in the file
+func (s *Sprite) HasGroupComposition() bool {
+	return s.flags&2 == 2 //ASE_FILE_FLAG_COMPOSITE_GROUPS
+}
+
+// HasLayerUUIDs returns true if layers store a UUID
+func (s *Sprite) HasLayerUUIDs() bool {
+	return s.flags&4 == 4 //ASE_FILE_FLAG_LAYER_WITH_UUID
+}
+
+// PaletteAt returns the palette active at frameIndex, palettes may change between frames
+func (s *Sprite) PaletteAt(frameIndex int) *Palette {
+	if frameIndex < 0 || frameIndex >= len(s.palettes) {
+		return nil
+	}
+	return s.palettes[frameIndex]
 }
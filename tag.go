@@ -7,13 +7,117 @@ import (
 	"io"
 )
 
+// Direction is the way the frames of a tag are played
+type Direction uint8
+
+const (
+	// DirectionForward plays frames from first to last
+	DirectionForward Direction = 0
+	// DirectionReverse plays frames from last to first
+	DirectionReverse Direction = 1
+	// DirectionPingPong plays frames forward then backward
+	DirectionPingPong Direction = 2
+	// DirectionPingPongReverse plays frames backward then forward
+	DirectionPingPongReverse Direction = 3
+)
+
+// String returns the name of the direction as shown in aseprite
+func (d Direction) String() string {
+	switch d {
+	case DirectionForward:
+		return "forward"
+	case DirectionReverse:
+		return "reverse"
+	case DirectionPingPong:
+		return "pingpong"
+	case DirectionPingPongReverse:
+		return "pingpong_reverse"
+	}
+	return fmt.Sprintf("direction(%d)", uint8(d))
+}
+
 // Tag represents animation groupings
 type Tag struct {
-	From               int16
-	To                 int16
-	Name               string
-	Color              color.RGBA
+	From  int16
+	To    int16
+	Name  string
+	Color color.RGBA
+	// AnimationDirection is the raw direction value.
+	//
+	// Deprecated: use Direction instead
 	AnimationDirection int8
+	Direction          Direction
+	// Repeat is how many times the tag is played, 0 means forever. Each pass of a ping-pong counts once
+	Repeat   uint16
+	UserData *UserData
+}
+
+// Cycle returns the frames of a single loop of the tag, which can be repeated forever.
+// Ping-pong cycles don't repeat the frames at both ends, e.g. 0 1 2 1 for frames 0 to 2
+func (t *Tag) Cycle() []int {
+	switch t.Direction {
+	case DirectionReverse:
+		return frameRange(int(t.To), int(t.From))
+	case DirectionPingPong:
+		frames := frameRange(int(t.From), int(t.To))
+		if t.To > t.From+1 {
+			frames = append(frames, frameRange(int(t.To)-1, int(t.From)+1)...)
+		}
+		return frames
+	case DirectionPingPongReverse:
+		frames := frameRange(int(t.To), int(t.From))
+		if t.To > t.From+1 {
+			frames = append(frames, frameRange(int(t.From)+1, int(t.To)-1)...)
+		}
+		return frames
+	}
+	return frameRange(int(t.From), int(t.To))
+}
+
+// Sequence returns every frame played by the tag, following Repeat.
+// Tags repeating forever return a single Cycle
+func (t *Tag) Sequence() []int {
+	if t.Repeat == 0 {
+		return t.Cycle()
+	}
+	if t.Direction != DirectionPingPong && t.Direction != DirectionPingPongReverse {
+		frames := []int{}
+		for i := 0; i < int(t.Repeat); i++ {
+			frames = append(frames, t.Cycle()...)
+		}
+		return frames
+	}
+
+	//each pass goes from one end to the other, skipping the frame the previous pass ended on
+	from, to := int(t.From), int(t.To)
+	if t.Direction == DirectionPingPongReverse {
+		from, to = to, from
+	}
+	frames := frameRange(from, to)
+	for i := 1; i < int(t.Repeat) && from != to; i++ {
+		from, to = to, from
+		step := 1
+		if to < from {
+			step = -1
+		}
+		frames = append(frames, frameRange(from+step, to)...)
+	}
+	return frames
+}
+
+// frameRange returns the frames from first to last, counting down if last is lower than first
+func frameRange(first int, last int) []int {
+	frames := []int{}
+	if first <= last {
+		for i := first; i <= last; i++ {
+			frames = append(frames, i)
+		}
+		return frames
+	}
+	for i := first; i >= last; i-- {
+		frames = append(frames, i)
+	}
+	return frames
 }
 
 func readTagChunk(f io.ReadSeeker, s *Sprite) error {
@@ -30,7 +134,9 @@ func readTagChunk(f io.ReadSeeker, s *Sprite) error {
 		return fmt.Errorf("seek tags: %w", err)
 	}
 	for c := int16(0); c < tagCount; c++ {
-		t := new(Tag)
+		t := &Tag{
+			UserData: &UserData{},
+		}
 		err = binary.Read(f, binary.LittleEndian, &t.From)
 		if err != nil {
 			return fmt.Errorf("from: %w", err)
@@ -39,18 +145,18 @@ func readTagChunk(f io.ReadSeeker, s *Sprite) error {
 		if err != nil {
 			return fmt.Errorf("to: %w", err)
 		}
-		var aniDir int8
+		var aniDir uint8
 		err = binary.Read(f, binary.LittleEndian, &aniDir)
 		if err != nil {
 			return fmt.Errorf("aniDir: %w", err)
 		}
-		if aniDir != 0 && //forward
-			aniDir != 1 && //reverse
-			aniDir != 2 { //ping pong
-			aniDir = 0
+		t.Direction = Direction(aniDir)
+		t.AnimationDirection = int8(aniDir)
+		err = binary.Read(f, binary.LittleEndian, &t.Repeat)
+		if err != nil {
+			return fmt.Errorf("repeat: %w", err)
 		}
-		t.AnimationDirection = aniDir
-		_, err = f.Seek(8, 1)
+		_, err = f.Seek(6, 1)
 		if err != nil {
 			return fmt.Errorf("seek rgb: %w", err)
 		}
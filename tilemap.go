@@ -0,0 +1,127 @@
+package aseprite
+
+import (
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+)
+
+// Tilemap represents the tiles of a tilemap cel
+type Tilemap struct {
+	// Width and Height are in tiles
+	Width  int
+	Height int
+	// Tiles are stored row by row
+	Tiles []Tile
+	// Tileset is the tileset of the owning tilemap layer, nil if it's missing from the file
+	Tileset *Tileset
+}
+
+// Tile is a single entry of a tilemap
+type Tile struct {
+	// ID is the index of the tile inside the tileset
+	ID    uint32
+	FlipX bool
+	FlipY bool
+	// Rotate90 is stored as the 90° CW rotation bit, aseprite applies it as a diagonal flip (swapping x and y)
+	// before FlipX and FlipY, so Rotate90 with FlipX rotates a tile 90° clockwise
+	Rotate90 bool
+}
+
+// At returns the tile at x, y in tiles
+func (tm *Tilemap) At(x int, y int) Tile {
+	if x < 0 || y < 0 || x >= tm.Width || y >= tm.Height {
+		return Tile{}
+	}
+	return tm.Tiles[y*tm.Width+x]
+}
+
+// readTiles reads zlib compressed 32 bit tiles, splitting them with the provided bitmasks
+func readTiles(f io.Reader, width int, height int, bitMaskTileID uint32, bitMaskXFlip uint32, bitMaskYFlip uint32, bitMask90CWRot uint32) ([]Tile, error) {
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("zlib: %w", err)
+	}
+	defer zr.Close()
+
+	data := make([]uint32, width*height)
+	err = binary.Read(zr, binary.LittleEndian, data)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	tiles := make([]Tile, len(data))
+	for i, value := range data {
+		tiles[i] = Tile{
+			ID:       value & bitMaskTileID,
+			FlipX:    value&bitMaskXFlip != 0,
+			FlipY:    value&bitMaskYFlip != 0,
+			Rotate90: value&bitMask90CWRot != 0,
+		}
+	}
+	return tiles, nil
+}
+
+// image draws the tilemap with its tileset, returns nil if the tileset has no tiles
+func (tm *Tilemap) image() *image.NRGBA {
+	ts := tm.Tileset
+	if ts == nil || len(ts.Tiles) == 0 {
+		return nil
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, tm.Width*int(ts.TileWidth), tm.Height*int(ts.TileHeight)))
+	tm.eachPixel(len(ts.Tiles), func(x, y int, tileID uint32, sx, sy int) {
+		img.SetNRGBA(x, y, ts.Tiles[tileID].NRGBAAt(sx, sy))
+	})
+	return img
+}
+
+// indexes draws the palette indices of the tilemap with its tileset, pixels without a tile are set to transparentIndex.
+// It returns nil if the tileset has no indexed tiles
+func (tm *Tilemap) indexes(transparentIndex int) *image.Paletted {
+	ts := tm.Tileset
+	if ts == nil || len(ts.tileIndexes) == 0 {
+		return nil
+	}
+	img := image.NewPaletted(image.Rect(0, 0, tm.Width*int(ts.TileWidth), tm.Height*int(ts.TileHeight)), ts.tileIndexes[0].Palette)
+	for i := range img.Pix {
+		img.Pix[i] = uint8(transparentIndex)
+	}
+	tm.eachPixel(len(ts.tileIndexes), func(x, y int, tileID uint32, sx, sy int) {
+		img.SetColorIndex(x, y, ts.tileIndexes[tileID].ColorIndexAt(sx, sy))
+	})
+	return img
+}
+
+// eachPixel calls fn for each pixel of the tilemap covered by one of the first tileCount tiles,
+// with the position of the pixel inside the tile once flipped and rotated
+func (tm *Tilemap) eachPixel(tileCount int, fn func(x, y int, tileID uint32, sx, sy int)) {
+	tw := int(tm.Tileset.TileWidth)
+	th := int(tm.Tileset.TileHeight)
+	for ty := 0; ty < tm.Height; ty++ {
+		for tx := 0; tx < tm.Width; tx++ {
+			tile := tm.At(tx, ty)
+			if int(tile.ID) >= tileCount {
+				continue
+			}
+			for y := 0; y < th; y++ {
+				for x := 0; x < tw; x++ {
+					sx, sy := x, y
+					if tile.FlipX {
+						sx = tw - 1 - sx
+					}
+					if tile.FlipY {
+						sy = th - 1 - sy
+					}
+					if tile.Rotate90 {
+						sx, sy = sy, sx
+					}
+					if sx >= tw || sy >= th {
+						continue
+					}
+					fn(tx*tw+x, ty*th+y, tile.ID, sx, sy)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package aseprite
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+)
+
+// Tileset represents a set of tiles used by tilemap layers
+type Tileset struct {
+	ID         uint32
+	Flags      uint32
+	TileCount  uint32
+	TileWidth  uint16
+	TileHeight uint16
+	// BaseIndex is the number displayed for the first tile in aseprite's UI
+	BaseIndex int16
+	Name      string
+	// ExternalFileID refers to an entry of the external files chunk when IsExternal is true
+	ExternalFileID uint32
+	// ExternalTilesetID is the id of the tileset inside the external file
+	ExternalTilesetID uint32
+	// Tiles holds one image per tile, it's empty when tiles are not embedded in the file
+	Tiles []*image.NRGBA
+	// tileIndexes holds the palette indices of each tile for indexed sprites
+	tileIndexes []*image.Paletted
+	UserData    *UserData
+	// TileUserData holds the user data of each tile
+	TileUserData []*UserData
+}
+
+// IsExternal returns true if the tileset links to an external file
+func (ts *Tileset) IsExternal() bool {
+	return ts.Flags&1 == 1 //ASE_TILESET_FLAG_EXTERNAL_FILE
+}
+
+// IsEmbedded returns true if the tiles are stored inside the file
+func (ts *Tileset) IsEmbedded() bool {
+	return ts.Flags&2 == 2 //ASE_TILESET_FLAG_EMBEDDED
+}
+
+// Tileset returns the tileset with provided id, or nil if it doesn't exist
+func (s *Sprite) Tileset(id uint32) *Tileset {
+	for _, ts := range s.Tilesets {
+		if ts.ID == id {
+			return ts
+		}
+	}
+	return nil
+}
+
+func readTilesetChunk(f io.ReadSeeker, s *Sprite, pal *Palette) (*Tileset, error) {
+	var err error
+	ts := &Tileset{
+		UserData: &UserData{},
+	}
+	err = binary.Read(f, binary.LittleEndian, &ts.ID)
+	if err != nil {
+		return nil, fmt.Errorf("id: %w", err)
+	}
+	err = binary.Read(f, binary.LittleEndian, &ts.Flags)
+	if err != nil {
+		return nil, fmt.Errorf("flags: %w", err)
+	}
+	err = binary.Read(f, binary.LittleEndian, &ts.TileCount)
+	if err != nil {
+		return nil, fmt.Errorf("tileCount: %w", err)
+	}
+	err = binary.Read(f, binary.LittleEndian, &ts.TileWidth)
+	if err != nil {
+		return nil, fmt.Errorf("tileWidth: %w", err)
+	}
+	err = binary.Read(f, binary.LittleEndian, &ts.TileHeight)
+	if err != nil {
+		return nil, fmt.Errorf("tileHeight: %w", err)
+	}
+	err = binary.Read(f, binary.LittleEndian, &ts.BaseIndex)
+	if err != nil {
+		return nil, fmt.Errorf("baseIndex: %w", err)
+	}
+	_, err = f.Seek(14, 1)
+	if err != nil {
+		return nil, fmt.Errorf("seek name: %w", err)
+	}
+	ts.Name, err = readString(f)
+	if err != nil {
+		return nil, fmt.Errorf("name: %w", err)
+	}
+	for i := uint32(0); i < ts.TileCount; i++ {
+		ts.TileUserData = append(ts.TileUserData, &UserData{})
+	}
+	if ts.IsExternal() {
+		err = binary.Read(f, binary.LittleEndian, &ts.ExternalFileID)
+		if err != nil {
+			return nil, fmt.Errorf("externalFileID: %w", err)
+		}
+		err = binary.Read(f, binary.LittleEndian, &ts.ExternalTilesetID)
+		if err != nil {
+			return nil, fmt.Errorf("externalTilesetID: %w", err)
+		}
+	}
+	if ts.IsEmbedded() {
+		var dataLength uint32
+		err = binary.Read(f, binary.LittleEndian, &dataLength)
+		if err != nil {
+			return nil, fmt.Errorf("dataLength: %w", err)
+		}
+		if ts.TileWidth == 0 || ts.TileHeight == 0 || ts.TileCount == 0 {
+			return ts, nil
+		}
+		//tiles are stored as a single strip, one tile below the other
+		strip, stripIndexes, err := readCompressedImage(io.LimitReader(f, int64(dataLength)), pixelFormatFromDepth(s.depth), int(ts.TileWidth), int(ts.TileHeight)*int(ts.TileCount), pal, int(s.transparentIndex))
+		if err != nil {
+			return nil, fmt.Errorf("tiles: %w", err)
+		}
+		for i := 0; i < int(ts.TileCount); i++ {
+			bounds := image.Rect(0, i*int(ts.TileHeight), int(ts.TileWidth), (i+1)*int(ts.TileHeight))
+			ts.Tiles = append(ts.Tiles, cropImage(strip, bounds))
+			if stripIndexes != nil {
+				ts.tileIndexes = append(ts.tileIndexes, cropPaletted(stripIndexes, bounds))
+			}
+		}
+	}
+	return ts, nil
+}
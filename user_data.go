@@ -9,8 +9,14 @@ import (
 
 // UserData represents user defined data
 type UserData struct {
-	Text  string
-	Color color.RGBA
+	Text       string
+	Color      color.RGBA
+	Properties Properties
+}
+
+// UserProperties returns the properties set by the user, as opposed to the ones set by extensions
+func (ud *UserData) UserProperties() PropertyMap {
+	return ud.Properties[0]
 }
 
 func (ud UserData) set(val UserData) {
@@ -62,5 +68,11 @@ func readUserDataChunk(f io.ReadSeeker, s *Sprite) (UserData, error) {
 		}
 		ud.Color = color.RGBA{R: r, G: g, B: b, A: a}
 	}
+	if flags&4 == 4 { //ASE_USER_DATA_FLAG_HAS_PROPERTIES
+		ud.Properties, err = readProperties(f)
+		if err != nil {
+			return ud, fmt.Errorf("properties: %w", err)
+		}
+	}
 	return ud, nil
 }
@@ -0,0 +1,11 @@
+package aseprite
+
+import "fmt"
+
+// UUID is a 128 bit universally unique identifier
+type UUID [16]byte
+
+// String returns the UUID in its canonical xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx form
+func (u UUID) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}